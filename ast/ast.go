@@ -11,6 +11,8 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	// Span returns the source range covered by the node
+	Span() token.Span
 }
 
 type Statement interface {
@@ -25,6 +27,8 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	// Comments after the last token, which the EOF token holds
+	TrailingComments []token.Comment
 }
 
 func (p *Program) String() string {
@@ -41,6 +45,14 @@ func (p *Program) TokenLiteral() string {
 	}
 	return output
 }
+func (p *Program) Span() token.Span {
+	if len(p.Statements) == 0 {
+		return token.Span{}
+	}
+	first := p.Statements[0].Span()
+	last := p.Statements[len(p.Statements)-1].Span()
+	return token.Span{Start: first.Start, End: last.End}
+}
 
 // Identifier implements Expression interface
 type Identifier struct {
@@ -52,6 +64,9 @@ func (id *Identifier) expressionNode() {}
 func (id *Identifier) TokenLiteral() string {
 	return id.Token.Literal
 }
+func (id *Identifier) Span() token.Span {
+	return id.Token.Span()
+}
 func (id *Identifier) String() string {
 	return id.Value
 }
@@ -66,10 +81,30 @@ func (i *IntegerLiteral) expressionNode() {}
 func (i *IntegerLiteral) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *IntegerLiteral) Span() token.Span {
+	return i.Token.Span()
+}
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
 
+// FloatLiteral implements Expression interface
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (f *FloatLiteral) expressionNode() {}
+func (f *FloatLiteral) TokenLiteral() string {
+	return f.Token.Literal
+}
+func (f *FloatLiteral) Span() token.Span {
+	return f.Token.Span()
+}
+func (f *FloatLiteral) String() string {
+	return f.Token.Literal
+}
+
 type BooleanLiteral struct {
 	Token token.Token
 	Value bool
@@ -79,6 +114,9 @@ func (b *BooleanLiteral) expressionNode() {}
 func (b *BooleanLiteral) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *BooleanLiteral) Span() token.Span {
+	return b.Token.Span()
+}
 func (b *BooleanLiteral) String() string {
 	return b.Token.Literal
 }
@@ -94,6 +132,9 @@ func (prefix *PrefixExpression) expressionNode() {}
 func (prefix *PrefixExpression) TokenLiteral() string {
 	return prefix.Token.Literal
 }
+func (prefix *PrefixExpression) Span() token.Span {
+	return token.Span{Start: prefix.Token.Pos, End: endOf(prefix.Right, prefix.Token.End)}
+}
 func (prefix *PrefixExpression) String() string {
 	return fmt.Sprintf("(%s%s)", prefix.Operator, prefix.Right.String())
 }
@@ -110,10 +151,37 @@ func (infix *InfixExpression) expressionNode() {}
 func (infix *InfixExpression) TokenLiteral() string {
 	return infix.Token.Literal
 }
+func (infix *InfixExpression) Span() token.Span {
+	return token.Span{Start: startOf(infix.Left, infix.Token.Pos), End: endOf(infix.Right, infix.Token.End)}
+}
 func (infix *InfixExpression) String() string {
 	return fmt.Sprintf("(%s %s %s)", infix.Left.String(), infix.Operator, infix.Right.String())
 }
 
+/*
+AssignExpression updates an existing binding or an element of an array or a
+hash, `x = 1`, `a[0] = 1` or with a compound operator `x += 1`. Target is an
+*Identifier or an *IndexExpression. The value of the expression is the
+assigned value.
+*/
+type AssignExpression struct {
+	Token    token.Token // The assignment operator token
+	Target   Expression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode() {}
+func (ae *AssignExpression) TokenLiteral() string {
+	return ae.Token.Literal
+}
+func (ae *AssignExpression) Span() token.Span {
+	return token.Span{Start: startOf(ae.Target, ae.Token.Pos), End: endOf(ae.Value, ae.Token.End)}
+}
+func (ae *AssignExpression) String() string {
+	return fmt.Sprintf("(%s %s %s)", ae.Target.String(), ae.Operator, ae.Value.String())
+}
+
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
@@ -124,6 +192,13 @@ func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Span() token.Span {
+	end := ls.Token.End
+	if ls.Name != nil {
+		end = ls.Name.Token.End
+	}
+	return token.Span{Start: ls.Token.Pos, End: endOf(ls.Value, end)}
+}
 func (ls *LetStatement) String() string {
 	value := ""
 	if ls.Value != nil {
@@ -141,6 +216,9 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Span() token.Span {
+	return token.Span{Start: rs.Token.Pos, End: endOf(rs.ReturnValue, rs.Token.End)}
+}
 func (rs *ReturnStatement) String() string {
 	val := ""
 	if rs.ReturnValue != nil {
@@ -158,6 +236,9 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Span() token.Span {
+	return token.Span{Start: es.Token.Pos, End: endOf(es.Expression, es.Token.End)}
+}
 func (es *ExpressionStatement) String() string {
 	val := ""
 	if es.Expression != nil {
@@ -177,6 +258,15 @@ func (ie *IfExpression) expressionNode() {}
 func (ie *IfExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IfExpression) Span() token.Span {
+	end := ie.Token.End
+	if ie.Alternative != nil {
+		end = ie.Alternative.Span().End
+	} else if ie.Consequence != nil {
+		end = ie.Consequence.Span().End
+	}
+	return token.Span{Start: ie.Token.Pos, End: end}
+}
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -195,12 +285,16 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // '{' token
 	Statements []Statement
+	RBrace     token.Token // '}' token
 }
 
 func (bs *BlockStatement) statementNode() {}
 func (bs *BlockStatement) TokenLiteral() string {
 	return bs.Token.Literal
 }
+func (bs *BlockStatement) Span() token.Span {
+	return token.Span{Start: bs.Token.Pos, End: closingEnd(bs.RBrace, bs.Token.End)}
+}
 
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
@@ -216,12 +310,21 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	// Name of the let binding the function is defined in, if any
+	Name string
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
 func (fl *FunctionLiteral) TokenLiteral() string {
 	return fl.Token.Literal
 }
+func (fl *FunctionLiteral) Span() token.Span {
+	end := fl.Token.End
+	if fl.Body != nil {
+		end = fl.Body.Span().End
+	}
+	return token.Span{Start: fl.Token.Pos, End: end}
+}
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -242,12 +345,16 @@ type CallExpression struct {
 	Token     token.Token // "(" token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+	RParen    token.Token // ")" token
 }
 
 func (ce *CallExpression) expressionNode() {}
 func (ce *CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
+func (ce *CallExpression) Span() token.Span {
+	return token.Span{Start: startOf(ce.Function, ce.Token.Pos), End: closingEnd(ce.RParen, ce.Token.End)}
+}
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 	args := []string{}
@@ -270,6 +377,9 @@ type StringLiteral struct {
 func (s *StringLiteral) TokenLiteral() string {
 	return s.Token.Literal
 }
+func (s *StringLiteral) Span() token.Span {
+	return s.Token.Span()
+}
 func (s *StringLiteral) String() string {
 	return s.TokenLiteral()
 }
@@ -278,6 +388,7 @@ func (s *StringLiteral) expressionNode() {}
 type ArrayLiteral struct {
 	Elements []Expression
 	Token    token.Token
+	RBracket token.Token // "]" token
 }
 
 func (a *ArrayLiteral) String() string {
@@ -294,18 +405,25 @@ func (a *ArrayLiteral) String() string {
 func (a *ArrayLiteral) TokenLiteral() string {
 	return a.Token.Literal
 }
+func (a *ArrayLiteral) Span() token.Span {
+	return token.Span{Start: a.Token.Pos, End: closingEnd(a.RBracket, a.Token.End)}
+}
 func (a *ArrayLiteral) expressionNode() {}
 
 type IndexExpression struct {
-	Token token.Token // "[" token
-	Left  Expression
-	Index Expression
+	Token    token.Token // "[" token
+	Left     Expression
+	Index    Expression
+	RBracket token.Token // "]" token
 }
 
 func (ie *IndexExpression) expressionNode() {}
 func (ie *IndexExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *IndexExpression) Span() token.Span {
+	return token.Span{Start: startOf(ie.Left, ie.Token.Pos), End: closingEnd(ie.RBracket, ie.Token.End)}
+}
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -316,20 +434,31 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// HashPair is a key and its value in a hash literal
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
 type HashLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	// In source order, which is the order keys are evaluated and inserted in
+	Pairs  []HashPair
+	RBrace token.Token // "}" token
 }
 
 func (hl *HashLiteral) expressionNode() {}
 func (hl *HashLiteral) TokenLiteral() string {
 	return hl.Token.Literal
 }
+func (hl *HashLiteral) Span() token.Span {
+	return token.Span{Start: hl.Token.Pos, End: closingEnd(hl.RBrace, hl.Token.End)}
+}
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+":"+pair.Value.String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -337,6 +466,32 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// startOf returns the start of node, or fallback when the node is missing
+// (e.g. after a parse error)
+func startOf(node Node, fallback token.Position) token.Position {
+	if node == nil {
+		return fallback
+	}
+	return node.Span().Start
+}
+
+// endOf returns the end of node, or fallback when the node is missing
+func endOf(node Node, fallback token.Position) token.Position {
+	if node == nil {
+		return fallback
+	}
+	return node.Span().End
+}
+
+// closingEnd returns the end of a closing delimiter token, or fallback when
+// the delimiter was never read
+func closingEnd(closing token.Token, fallback token.Position) token.Position {
+	if !closing.End.IsValid() {
+		return fallback
+	}
+	return closing.End
+}
+
 // Compile time checks
 var _ Expression = (*Identifier)(nil)
 var _ Expression = (*IntegerLiteral)(nil)
@@ -351,3 +506,78 @@ var _ Expression = (*StringLiteral)(nil)
 var _ Expression = (*ArrayLiteral)(nil)
 var _ Expression = (*IndexExpression)(nil)
 var _ Expression = (*HashLiteral)(nil)
+
+type WhileStatement struct {
+	Token     token.Token // The 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode() {}
+func (ws *WhileStatement) TokenLiteral() string {
+	return ws.Token.Literal
+}
+func (ws *WhileStatement) Span() token.Span {
+	end := ws.Token.End
+	if ws.Body != nil {
+		end = ws.Body.Span().End
+	}
+	return token.Span{Start: ws.Token.Pos, End: end}
+}
+func (ws *WhileStatement) String() string {
+	return fmt.Sprintf("while %s %s", ws.Condition.String(), ws.Body.String())
+}
+
+// ForStatement iterates over the elements of an array, the keys of a hash or
+// the characters of a string
+type ForStatement struct {
+	Token    token.Token // The 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForStatement) statementNode() {}
+func (fs *ForStatement) TokenLiteral() string {
+	return fs.Token.Literal
+}
+func (fs *ForStatement) Span() token.Span {
+	end := fs.Token.End
+	if fs.Body != nil {
+		end = fs.Body.Span().End
+	}
+	return token.Span{Start: fs.Token.Pos, End: end}
+}
+func (fs *ForStatement) String() string {
+	return fmt.Sprintf("for (%s in %s) %s", fs.Variable.String(), fs.Iterable.String(), fs.Body.String())
+}
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+func (bs *BreakStatement) TokenLiteral() string {
+	return bs.Token.Literal
+}
+func (bs *BreakStatement) Span() token.Span {
+	return bs.Token.Span()
+}
+func (bs *BreakStatement) String() string {
+	return "break;"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+func (cs *ContinueStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ContinueStatement) Span() token.Span {
+	return cs.Token.Span()
+}
+func (cs *ContinueStatement) String() string {
+	return "continue;"
+}
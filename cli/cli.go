@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
+	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
+	"github.com/zawlinnnaing/monkey-language-in-golang/repl"
+	"github.com/zawlinnnaing/monkey-language-in-golang/vm"
+)
+
+// Exit statuses returned by Run
+const (
+	EXIT_OK    = 0
+	EXIT_ERROR = 1
+	EXIT_USAGE = 2
+)
+
+// Name of the global holding the script arguments
+const ARGS_IDENTIFIER = "args"
+
+const USAGE = `Usage:
+  monkey                          start the REPL
+  monkey repl [-engine ENGINE]    start the REPL with the given engine
+  monkey run [flags] FILE [ARGS]  run a script, ARGS are available as the "args" array
+  monkey FILE [ARGS]              same as "monkey run", for "#!/usr/bin/env monkey" scripts
+
+Flags for run:
+`
+
+/*
+Run executes the command line arguments (without the program name) and
+returns the exit status of the process. Without arguments it starts the REPL
+on the standard input.
+*/
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return replCommand(args, stdout, stderr)
+	}
+	switch args[0] {
+	case "run":
+		return runCommand(args[1:], stderr)
+	case "repl":
+		return replCommand(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		flags, _ := newRunFlagSet(stdout)
+		printUsage(stdout, flags)
+		return EXIT_OK
+	default:
+		return runCommand(args, stderr)
+	}
+}
+
+type runOptions struct {
+	errorFormat string
+	engine      string
+}
+
+func newRunFlagSet(output io.Writer) (*flag.FlagSet, *runOptions) {
+	options := &runOptions{}
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&options.errorFormat, "error-format", "text", "format of parser errors, text or json")
+	addEngineFlag(flags, &options.engine)
+	return flags, options
+}
+
+func addEngineFlag(flags *flag.FlagSet, engine *string) {
+	flags.StringVar(engine, "engine", repl.ENGINE_EVAL, "engine executing the program, eval (tree-walking evaluator) or vm (bytecode virtual machine)")
+}
+
+func validEngine(engine string, stderr io.Writer) bool {
+	if engine != repl.ENGINE_EVAL && engine != repl.ENGINE_VM {
+		fmt.Fprintf(stderr, "monkey: unknown engine %q\n", engine)
+		return false
+	}
+	return true
+}
+
+func replCommand(args []string, stdout, stderr io.Writer) int {
+	var engine string
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	addEngineFlag(flags, &engine)
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if !validEngine(engine, stderr) {
+		return EXIT_USAGE
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(stdout, "Hello, %v. Welcome to the monkey programming language! \n", user.Username)
+	fmt.Fprintln(stdout, "Type a command")
+	repl.Start(os.Stdin, stdout, engine)
+	return EXIT_OK
+}
+
+func printUsage(out io.Writer, flags *flag.FlagSet) {
+	io.WriteString(out, USAGE)
+	flags.SetOutput(out)
+	flags.PrintDefaults()
+}
+
+func runCommand(args []string, stderr io.Writer) int {
+	flags, options := newRunFlagSet(stderr)
+	flags.Usage = func() { printUsage(stderr, flags) }
+	// Flags are only parsed up to the script path, the rest belongs to the script
+	if err := flags.Parse(args); err != nil {
+		return EXIT_USAGE
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "monkey: missing script file")
+		flags.Usage()
+		return EXIT_USAGE
+	}
+	if options.errorFormat != "text" && options.errorFormat != "json" {
+		fmt.Fprintf(stderr, "monkey: unknown error format %q\n", options.errorFormat)
+		return EXIT_USAGE
+	}
+	if !validEngine(options.engine, stderr) {
+		return EXIT_USAGE
+	}
+
+	filename := flags.Arg(0)
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(stderr, "monkey: %v\n", err)
+		return EXIT_ERROR
+	}
+
+	p := parser.New(lexer.NewScript(filename, string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		if options.errorFormat == "json" {
+			diagnostic.WriteJSON(stderr, p.Errors())
+		} else {
+			diagnostic.RenderAll(stderr, string(source), p.Errors())
+		}
+		return EXIT_ERROR
+	}
+
+	arguments := scriptArgs(flags.Args()[1:])
+	var result object.Object
+	if options.engine == repl.ENGINE_VM {
+		session := vm.NewSession()
+		session.Define(ARGS_IDENTIFIER, arguments)
+		result = session.Run(program)
+	} else {
+		env := object.NewEnvironment()
+		env.Set(ARGS_IDENTIFIER, arguments)
+		result = evaluator.Eval(program, env)
+	}
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintln(stderr, errObj.StackTrace())
+		return EXIT_ERROR
+	}
+	return EXIT_OK
+}
+
+func scriptArgs(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+	return &object.Array{Elements: elements}
+}
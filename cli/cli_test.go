@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/repl"
+)
+
+func writeScript(t *testing.T, source string) string {
+	path := filepath.Join(t.TempDir(), "script.mk")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatalf("could not write script: %v", err)
+	}
+	return path
+}
+
+func TestRunScript(t *testing.T) {
+	testCases := []struct {
+		name           string
+		source         string
+		args           []string
+		expectedStatus int
+		expectedStderr string
+	}{
+		{
+			name:           "successful script",
+			source:         "let add = fn(a, b) { a + b }; add(1, 2);",
+			expectedStatus: EXIT_OK,
+		},
+		{
+			name:           "shebang line",
+			source:         "#!/usr/bin/env monkey\nlet x = 1;",
+			expectedStatus: EXIT_OK,
+		},
+		{
+			name:           "script arguments",
+			source:         `if (len(args) != 2) { "wrong args" - 1 }; {"a": 1}[first(args)] + {"b": 1}[last(args)]`,
+			args:           []string{"a", "b"},
+			expectedStatus: EXIT_OK,
+		},
+		{
+			name:           "parser error",
+			source:         "let x = (5;",
+			expectedStatus: EXIT_ERROR,
+			expectedStderr: "script.mk:1:11",
+		},
+		{
+			name:           "runtime error",
+			source:         "5 + true;",
+			expectedStatus: EXIT_ERROR,
+			expectedStderr: "ERROR: type mismatch: INTEGER + BOOLEAN",
+		},
+	}
+
+	for _, engine := range []string{repl.ENGINE_EVAL, repl.ENGINE_VM} {
+		for _, testCase := range testCases {
+			t.Run(engine+"/"+testCase.name, func(t *testing.T) {
+				path := writeScript(t, testCase.source)
+				var stdout, stderr bytes.Buffer
+				status := Run(append([]string{"run", "-engine", engine, path}, testCase.args...), &stdout, &stderr)
+				if status != testCase.expectedStatus {
+					t.Errorf("Expected exit status %d, received %d (stderr: %q)", testCase.expectedStatus, status, stderr.String())
+				}
+				if !strings.Contains(stderr.String(), testCase.expectedStderr) {
+					t.Errorf("Expected stderr to contain %q, received %q", testCase.expectedStderr, stderr.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRunWithoutSubcommand(t *testing.T) {
+	path := writeScript(t, "let x = 1;")
+	var stdout, stderr bytes.Buffer
+	if status := Run([]string{path}, &stdout, &stderr); status != EXIT_OK {
+		t.Errorf("Expected exit status %d, received %d (stderr: %q)", EXIT_OK, status, stderr.String())
+	}
+}
+
+func TestRunJSONErrors(t *testing.T) {
+	path := writeScript(t, "let = 1;")
+	var stdout, stderr bytes.Buffer
+	status := Run([]string{"run", "-error-format", "json", path}, &stdout, &stderr)
+	if status != EXIT_ERROR {
+		t.Errorf("Expected exit status %d, received %d", EXIT_ERROR, status)
+	}
+	if !strings.Contains(stderr.String(), `"code": "E0001"`) {
+		t.Errorf("Expected JSON diagnostics, received %q", stderr.String())
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := Run([]string{"run"}, &stdout, &stderr); status != EXIT_USAGE {
+		t.Errorf("Expected exit status %d, received %d", EXIT_USAGE, status)
+	}
+	if status := Run([]string{"run", "-engine", "jit", "script.mk"}, &stdout, &stderr); status != EXIT_USAGE {
+		t.Errorf("Expected exit status %d, received %d", EXIT_USAGE, status)
+	}
+	if status := Run([]string{"run", "does-not-exist.mk"}, &stdout, &stderr); status != EXIT_ERROR {
+		t.Errorf("Expected exit status %d, received %d", EXIT_ERROR, status)
+	}
+}
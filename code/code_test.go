@@ -0,0 +1,87 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	testCases := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpClosure, []int{65534, 255}, []byte{byte(OpClosure), 255, 254, 255}},
+	}
+
+	for _, testCase := range testCases {
+		instruction := Make(testCase.op, testCase.operands...)
+		if len(instruction) != len(testCase.expected) {
+			t.Errorf("Expected instruction length %d, received %d", len(testCase.expected), len(instruction))
+			continue
+		}
+		for i, b := range testCase.expected {
+			if instruction[i] != b {
+				t.Errorf("Expected byte %d to be %d, received %d", i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("Instructions wrongly formatted.\nexpected=%q\nreceived=%q", expected, concatted.String())
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	testCases := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpClosure, []int{65535, 255}, 3},
+	}
+
+	for _, testCase := range testCases {
+		instruction := Make(testCase.op, testCase.operands...)
+
+		def, err := Lookup(byte(testCase.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != testCase.bytesRead {
+			t.Fatalf("Expected %d bytes read, received %d", testCase.bytesRead, n)
+		}
+
+		for i, expected := range testCase.operands {
+			if operandsRead[i] != expected {
+				t.Errorf("Expected operand %d to be %d, received %d", i, expected, operandsRead[i])
+			}
+		}
+	}
+}
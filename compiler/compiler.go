@@ -0,0 +1,731 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+// Limits imposed by the operand widths
+const (
+	MAX_CONSTANTS = 1 << 16
+	MAX_LOCALS    = 1 << 8
+	MAX_ARGUMENTS = 1 << 8
+	MAX_JUMP      = 1 << 16
+)
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"**": code.OpPow,
+	"&":  code.OpBitAnd,
+	"|":  code.OpBitOr,
+	"^":  code.OpBitXor,
+	"<<": code.OpShiftLeft,
+	">>": code.OpShiftRight,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+}
+
+var prefixOpcodes = map[string]code.Opcode{
+	"!": code.OpBang,
+	"-": code.OpMinus,
+	"~": code.OpBitNot,
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+type CompilationScope struct {
+	instructions        code.Instructions
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	positions           map[int]token.Position
+	// Loops being compiled, innermost last
+	loops []*loop
+	// Values the enclosing expressions of the node being compiled left on the stack
+	pending int
+}
+
+// loop records the jumps of break and continue statements
+type loop struct {
+	start int
+	// Values on the stack when the loop was entered, break and continue pop the ones above
+	pending int
+	// Offsets of the jumps of break statements, patched once the loop end is known
+	breaks []int
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// Source position of the node being compiled
+	position token.Position
+}
+
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	// Source positions by instruction offset
+	Positions map[int]token.Position
+}
+
+func New() *Compiler {
+	return NewWithState(NewGlobalSymbolTable(), []object.Object{})
+}
+
+// NewWithState creates a compiler that keeps the globals and constants of
+// earlier compilations, e.g. between REPL lines
+func NewWithState(symbolTable *SymbolTable, constants []object.Object) *Compiler {
+	mainScope := CompilationScope{
+		instructions: code.Instructions{},
+		positions:    make(map[int]token.Position),
+	}
+	return &Compiler{
+		constants:   constants,
+		symbolTable: symbolTable,
+		scopes:      []CompilationScope{mainScope},
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	previousPosition := c.position
+	c.position = nodePosition(node)
+	defer func() { c.position = previousPosition }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return c.compileProgram(node)
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			if err := c.Compile(statement); err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		return c.compileLetStatement(node)
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return c.errorf("identifier not found: %s", node.Value)
+		}
+		c.loadSymbol(symbol)
+	case *ast.IntegerLiteral:
+		return c.emitConstant(&object.Integer{Value: node.Value})
+	case *ast.FloatLiteral:
+		return c.emitConstant(&object.Float{Value: node.Value})
+	case *ast.StringLiteral:
+		return c.emitConstant(&object.String{Value: node.Value})
+	case *ast.BooleanLiteral:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.PrefixExpression:
+		opcode, ok := prefixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.emit(opcode)
+	case *ast.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return c.compileLogicalExpression(node)
+		}
+		opcode, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compilePending(node.Right, 1); err != nil {
+			return err
+		}
+		c.emit(opcode)
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+	case *ast.ArrayLiteral:
+		for i, element := range node.Elements {
+			if err := c.compilePending(element, i); err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpArray, len(node.Elements))
+	case *ast.HashLiteral:
+		return c.compileHashLiteral(node)
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.compilePending(node.Index, 1); err != nil {
+			return err
+		}
+		c.emit(code.OpIndex)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		return c.compileCallExpression(node)
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		loop, err := c.currentLoop()
+		if err != nil {
+			return err
+		}
+		c.unwindTo(loop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		loop, err := c.currentLoop()
+		if err != nil {
+			return err
+		}
+		c.unwindTo(loop)
+		c.emit(code.OpJump, loop.start)
+	default:
+		return c.errorf("cannot compile %T", node)
+	}
+	return nil
+}
+
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	for _, statement := range program.Statements {
+		if err := c.Compile(statement); err != nil {
+			return err
+		}
+	}
+	// Like the evaluator, a program ending with a let statement results in null
+	if len(program.Statements) > 0 {
+		if _, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); !ok {
+			c.emit(code.OpNull)
+			c.emit(code.OpPop)
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileLetStatement(node *ast.LetStatement) error {
+	var symbol Symbol
+	// Functions are bound before their body is compiled, so they can call
+	// themselves. Other values can still refer to a previous binding.
+	if _, ok := node.Value.(*ast.FunctionLiteral); ok {
+		symbol = c.symbolTable.Define(node.Name.Value)
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol = c.symbolTable.Define(node.Name.Value)
+	}
+
+	return c.storeSymbol(symbol)
+}
+
+// compileLogicalExpression skips the right operand when the left one decides the result
+func (c *Compiler) compileLogicalExpression(node *ast.InfixExpression) error {
+	if err := c.Compile(node.Left); err != nil {
+		return err
+	}
+	opcode := code.OpJumpNotTruthyOrPop
+	if node.Operator == "||" {
+		opcode = code.OpJumpTruthyOrPop
+	}
+	jumpPosition := c.emit(opcode, 9999)
+	if err := c.Compile(node.Right); err != nil {
+		return err
+	}
+	return c.changeOperand(jumpPosition, len(c.currentInstructions()))
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loop := c.enterLoop()
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitPosition := c.emit(code.OpJumpNotTruthy, 9999)
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loop.start)
+	if err := c.changeOperand(exitPosition, len(c.currentInstructions())); err != nil {
+		return err
+	}
+	return c.leaveLoop()
+}
+
+/*
+compileForStatement keeps the iterator in a binding named after the loop
+depth, `$` can't appear in identifiers so the program can't refer to it.
+Like the evaluator, the loop variable is bound in the enclosing scope.
+*/
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+	iterator := c.symbolTable.Define(fmt.Sprintf("$iterator%d", len(c.currentScope().loops)))
+	if err := c.storeSymbol(iterator); err != nil {
+		return err
+	}
+
+	loop := c.enterLoop()
+	c.loadSymbol(iterator)
+	exitPosition := c.emit(code.OpIterNext, 9999)
+	if err := c.storeSymbol(c.symbolTable.Define(node.Variable.Value)); err != nil {
+		return err
+	}
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.emit(code.OpJump, loop.start)
+	if err := c.changeOperand(exitPosition, len(c.currentInstructions())); err != nil {
+		return err
+	}
+	return c.leaveLoop()
+}
+
+func (c *Compiler) enterLoop() *loop {
+	scope := c.currentScope()
+	loop := &loop{start: len(scope.instructions), pending: scope.pending}
+	scope.loops = append(scope.loops, loop)
+	return loop
+}
+
+// leaveLoop patches the break statements to jump past the end of the loop
+func (c *Compiler) leaveLoop() error {
+	scope := c.currentScope()
+	loop := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+	for _, position := range loop.breaks {
+		if err := c.changeOperand(position, len(scope.instructions)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+compilePending compiles node while the enclosing expression has already left
+pending values on the stack, e.g. the left operand of an infix expression.
+*/
+func (c *Compiler) compilePending(node ast.Node, pending int) error {
+	c.currentScope().pending += pending
+	err := c.Compile(node)
+	c.currentScope().pending -= pending
+	return err
+}
+
+// unwindTo pops the values left on the stack since loop was entered, e.g. by
+// `1 + if (x) { break }`, before jumping out of the loop
+func (c *Compiler) unwindTo(loop *loop) {
+	for i := loop.pending; i < c.currentScope().pending; i++ {
+		c.emit(code.OpPop)
+	}
+}
+
+func (c *Compiler) currentLoop() (*loop, error) {
+	loops := c.currentScope().loops
+	if len(loops) == 0 {
+		return nil, c.errorf("break or continue outside of a loop")
+	}
+	return loops[len(loops)-1], nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	// Placeholder offset, patched once the consequence is compiled
+	jumpNotTruthyPosition := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBlockValue(node.Consequence); err != nil {
+		return err
+	}
+	jumpPosition := c.emit(code.OpJump, 9999)
+	if err := c.changeOperand(jumpNotTruthyPosition, len(c.currentInstructions())); err != nil {
+		return err
+	}
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBlockValue(node.Alternative); err != nil {
+		return err
+	}
+	return c.changeOperand(jumpPosition, len(c.currentInstructions()))
+}
+
+// compileBlockValue compiles a block used as an expression, leaving its last value on the stack
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		// Empty block or block ending with a let statement
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) compileHashLiteral(node *ast.HashLiteral) error {
+	for i, pair := range node.Pairs {
+		if err := c.compilePending(pair.Key, 2*i); err != nil {
+			return err
+		}
+		if err := c.compilePending(pair.Value, 2*i+1); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpHash, len(node.Pairs)*2)
+	return nil
+}
+
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	c.enterScope()
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+	for _, parameter := range node.Parameters {
+		c.symbolTable.Define(parameter.Value)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.numDefinitions
+	if numLocals > MAX_LOCALS {
+		return c.errorf("too many local bindings")
+	}
+	positions := c.currentScope().positions
+	instructions := c.leaveScope()
+
+	for _, symbol := range freeSymbols {
+		c.captureSymbol(symbol)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Name:          node.Name,
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Positions:     positions,
+	}
+	index, err := c.addConstant(compiledFn)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpClosure, index, len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) compileCallExpression(node *ast.CallExpression) error {
+	if err := c.Compile(node.Function); err != nil {
+		return err
+	}
+	if len(node.Arguments) >= MAX_ARGUMENTS {
+		return c.errorf("too many arguments")
+	}
+	for i, argument := range node.Arguments {
+		if err := c.compilePending(argument, 1+i); err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpCall, len(node.Arguments))
+	return nil
+}
+
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return c.compileIndexAssignExpression(node, target)
+	}
+
+	name := node.Target.(*ast.Identifier).Value
+	symbol, ok := c.symbolTable.ResolveBinding(name)
+	if !ok || symbol.Scope == BUILTIN_SCOPE {
+		return c.errorf("cannot assign to undeclared identifier: %s", name)
+	}
+
+	var opcode code.Opcode
+	if node.Operator != "=" {
+		opcode, ok = infixOpcodes[strings.TrimSuffix(node.Operator, "=")]
+		if !ok {
+			return c.errorf("unknown operator: %s", node.Operator)
+		}
+		c.loadSymbol(symbol)
+	}
+	pending := 0
+	if node.Operator != "=" {
+		pending = 1
+	}
+	if err := c.compilePending(node.Value, pending); err != nil {
+		return err
+	}
+	if node.Operator != "=" {
+		c.emit(opcode)
+	}
+
+	// The assigned value is the value of the expression
+	if err := c.storeSymbol(symbol); err != nil {
+		return err
+	}
+	c.loadSymbol(symbol)
+	return nil
+}
+
+func (c *Compiler) compileIndexAssignExpression(node *ast.AssignExpression, target *ast.IndexExpression) error {
+	if err := c.Compile(target.Left); err != nil {
+		return err
+	}
+	if err := c.compilePending(target.Index, 1); err != nil {
+		return err
+	}
+	if node.Operator == "=" {
+		if err := c.compilePending(node.Value, 2); err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+		return nil
+	}
+
+	opcode, ok := infixOpcodes[strings.TrimSuffix(node.Operator, "=")]
+	if !ok {
+		return c.errorf("unknown operator: %s", node.Operator)
+	}
+	// Container and index are evaluated once, for both reading and writing
+	c.emit(code.OpDupPair)
+	c.emit(code.OpIndex)
+	if err := c.compilePending(node.Value, 3); err != nil {
+		return err
+	}
+	c.emit(opcode)
+	c.emit(code.OpSetIndex)
+	return nil
+}
+
+// captureSymbol emits the instruction passing a free variable to a new closure
+func (c *Compiler) captureSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case LOCAL_SCOPE:
+		c.emit(code.OpCaptureLocal, symbol.Index)
+	case FREE_SCOPE:
+		c.emit(code.OpCaptureFree, symbol.Index)
+	default:
+		c.loadSymbol(symbol)
+		c.emit(code.OpCaptureValue)
+	}
+}
+
+// storeSymbol emits the instruction popping the top of the stack into a binding
+func (c *Compiler) storeSymbol(symbol Symbol) error {
+	switch symbol.Scope {
+	case GLOBAL_SCOPE:
+		c.emit(code.OpSetGlobal, symbol.Index)
+	case LOCAL_SCOPE:
+		if symbol.Index >= MAX_LOCALS {
+			return c.errorf("too many local bindings")
+		}
+		c.emit(code.OpSetLocal, symbol.Index)
+	case FREE_SCOPE:
+		c.emit(code.OpSetFree, symbol.Index)
+	}
+	return nil
+}
+
+func (c *Compiler) loadSymbol(symbol Symbol) {
+	switch symbol.Scope {
+	case GLOBAL_SCOPE:
+		c.emit(code.OpGetGlobal, symbol.Index)
+	case LOCAL_SCOPE:
+		c.emit(code.OpGetLocal, symbol.Index)
+	case BUILTIN_SCOPE:
+		c.emit(code.OpGetBuiltin, symbol.Index)
+	case FREE_SCOPE:
+		c.emit(code.OpGetFree, symbol.Index)
+	case FUNCTION_SCOPE:
+		c.emit(code.OpCurrentClosure)
+	}
+}
+
+func (c *Compiler) addConstant(obj object.Object) (int, error) {
+	if len(c.constants) >= MAX_CONSTANTS {
+		return 0, c.errorf("too many constants")
+	}
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1, nil
+}
+
+func (c *Compiler) emitConstant(obj object.Object) error {
+	index, err := c.addConstant(obj)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpConstant, index)
+	return nil
+}
+
+// emit appends an instruction to the current scope and returns its offset
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	instruction := code.Make(op, operands...)
+	position := c.addInstruction(instruction)
+	c.setLastInstruction(op, position)
+	if c.position.IsValid() {
+		c.currentScope().positions[position] = c.position
+	}
+	return position
+}
+
+func (c *Compiler) addInstruction(instruction []byte) int {
+	position := len(c.currentInstructions())
+	c.scopes[c.scopeIndex].instructions = append(c.currentInstructions(), instruction...)
+	return position
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, position int) {
+	scope := c.currentScope()
+	scope.previousInstruction = scope.lastInstruction
+	scope.lastInstruction = EmittedInstruction{Opcode: op, Position: position}
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.currentScope().lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := c.currentScope()
+	last := scope.lastInstruction
+	scope.instructions = scope.instructions[:last.Position]
+	delete(scope.positions, last.Position)
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPosition := c.currentScope().lastInstruction.Position
+	c.replaceInstruction(lastPosition, code.Make(code.OpReturnValue))
+	c.currentScope().lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(position int, newInstruction []byte) {
+	instructions := c.currentInstructions()
+	for i := 0; i < len(newInstruction); i++ {
+		instructions[position+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPosition int, operand int) error {
+	if operand >= MAX_JUMP {
+		return c.errorf("program too large")
+	}
+	op := code.Opcode(c.currentInstructions()[opPosition])
+	c.replaceInstruction(opPosition, code.Make(op, operand))
+	return nil
+}
+
+func (c *Compiler) currentScope() *CompilationScope {
+	return &c.scopes[c.scopeIndex]
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.currentScope().instructions
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{
+		instructions: code.Instructions{},
+		positions:    make(map[int]token.Position),
+	})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+type CompileError struct {
+	Message string
+	Pos     token.Position
+}
+
+func (e *CompileError) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("%s: %s", e.Pos, e.Message)
+	}
+	return e.Message
+}
+
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	return &CompileError{Message: fmt.Sprintf(format, a...), Pos: c.position}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Constants:    c.constants,
+		Positions:    c.currentScope().positions,
+	}
+}
+
+// nodePosition is the position runtime errors of a node are reported at,
+// the same as in the evaluator
+func nodePosition(node ast.Node) token.Position {
+	if node == nil {
+		return token.Position{}
+	}
+	if infix, ok := node.(*ast.InfixExpression); ok {
+		return infix.Token.Pos
+	}
+	return node.Span().Start
+}
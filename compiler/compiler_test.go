@@ -0,0 +1,343 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
+)
+
+func concatInstructions(instructions ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, instruction := range instructions {
+		out = append(out, instruction...)
+	}
+	return out
+}
+
+func testCompile(t *testing.T, input string) *Bytecode {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("Input %q has parser errors: %v", input, p.Errors())
+	}
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("Input %q: compiler error: %s", input, err)
+	}
+	return compiler.Bytecode()
+}
+
+func TestCompile(t *testing.T) {
+	testCases := []struct {
+		input                string
+		expectedConstants    []string
+		expectedInstructions code.Instructions
+	}{
+		{
+			"1 + 2",
+			[]string{"1", "2"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"-1; !true",
+			[]string{"1"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+				code.Make(code.OpTrue),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"if (true) { 10 }; 3333;",
+			[]string{"10", "3333"},
+			concatInstructions(
+				code.Make(code.OpTrue),              // 0000
+				code.Make(code.OpJumpNotTruthy, 10), // 0001
+				code.Make(code.OpConstant, 0),       // 0004
+				code.Make(code.OpJump, 11),          // 0007
+				code.Make(code.OpNull),              // 0010
+				code.Make(code.OpPop),               // 0011
+				code.Make(code.OpConstant, 1),       // 0012
+				code.Make(code.OpPop),               // 0015
+			),
+		},
+		{
+			"let one = 1; one;",
+			[]string{"1"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"let one = 1;",
+			[]string{"1"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			`[1, 2][0]; {"a": 1}`,
+			[]string{"1", "2", "0", "a", "1"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpArray, 2),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpIndex),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpHash, 2),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			// Pairs are compiled in source order
+			`{"b": 1, "a": 2}`,
+			[]string{"b", "1", "a", "2"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"len([])",
+			[]string{},
+			concatInstructions(
+				code.Make(code.OpGetBuiltin, builtinIndex(t, "len")),
+				code.Make(code.OpArray, 0),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"fn(a) { fn(b) { a + b } }",
+			[]string{
+				concatInstructions(
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				).String(),
+				concatInstructions(
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 0, 1),
+					code.Make(code.OpReturnValue),
+				).String(),
+			},
+			concatInstructions(
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"let x = 1; x += 2;",
+			[]string{"1", "2"},
+			concatInstructions(
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"fn() { let a = 1; fn() { a = 2 } }",
+			[]string{
+				"1",
+				"2",
+				concatInstructions(
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSetFree, 0),
+					code.Make(code.OpGetFree, 0),
+					code.Make(code.OpReturnValue),
+				).String(),
+				concatInstructions(
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpCaptureLocal, 0),
+					code.Make(code.OpClosure, 2, 1),
+					code.Make(code.OpReturnValue),
+				).String(),
+			},
+			concatInstructions(
+				code.Make(code.OpClosure, 3, 0),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"true && false || 1",
+			[]string{"1"},
+			concatInstructions(
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthyOrPop, 5),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpJumpTruthyOrPop, 11),
+				// 0008
+				code.Make(code.OpConstant, 0),
+				// 0011
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"while (true) { break; continue; }",
+			[]string{},
+			concatInstructions(
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 13),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+				// 0013
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			),
+		},
+		{
+			"for (x in [1]) { x }",
+			[]string{"1"},
+			concatInstructions(
+				// 0000
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpIter),
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpIterNext, 26),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpGetGlobal, 1),
+				code.Make(code.OpPop),
+				code.Make(code.OpJump, 10),
+				// 0026
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			),
+		},
+	}
+
+	for _, testCase := range testCases {
+		bytecode := testCompile(t, testCase.input)
+		if bytecode.Instructions.String() != testCase.expectedInstructions.String() {
+			t.Errorf("Input %q: expected instructions:\n%s\nreceived:\n%s", testCase.input, testCase.expectedInstructions, bytecode.Instructions)
+		}
+		if len(bytecode.Constants) != len(testCase.expectedConstants) {
+			t.Errorf("Input %q: expected %d constants, received %d", testCase.input, len(testCase.expectedConstants), len(bytecode.Constants))
+			continue
+		}
+		for i, expected := range testCase.expectedConstants {
+			received := bytecode.Constants[i].Inspect()
+			if fn, ok := bytecode.Constants[i].(*object.CompiledFunction); ok {
+				received = fn.Instructions.String()
+			}
+			if received != expected {
+				t.Errorf("Input %q: expected constant %d to be %s, received %s", testCase.input, i, expected, received)
+			}
+		}
+	}
+}
+
+func builtinIndex(t *testing.T, name string) int {
+	symbol, ok := NewGlobalSymbolTable().Resolve(name)
+	if !ok || symbol.Scope != BUILTIN_SCOPE {
+		t.Fatalf("Expected builtin %s to be defined", name)
+	}
+	return symbol.Index
+}
+
+func TestCompileErrors(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedMessage  string
+		expectedPosition string
+	}{
+		{"a", "identifier not found: a", "1:1"},
+		{"let f = fn() {\n  b\n};", "identifier not found: b", "2:3"},
+		{"x = 1", "cannot assign to undeclared identifier: x", "1:1"},
+		{"len = 1", "cannot assign to undeclared identifier: len", "1:1"},
+	}
+
+	for _, testCase := range testCases {
+		p := parser.New(lexer.New(testCase.input))
+		err := New().Compile(p.ParseProgram())
+		compileErr, ok := err.(*CompileError)
+		if !ok {
+			t.Errorf("Input %q: expected *CompileError, received %T (%v)", testCase.input, err, err)
+			continue
+		}
+		if compileErr.Message != testCase.expectedMessage {
+			t.Errorf("Expected message %q, received %q", testCase.expectedMessage, compileErr.Message)
+		}
+		if compileErr.Pos.String() != testCase.expectedPosition {
+			t.Errorf("Expected position %s, received %s", testCase.expectedPosition, compileErr.Pos)
+		}
+	}
+}
+
+func TestResolveSymbols(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("b")
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("c")
+
+	testCases := []struct {
+		name     string
+		expected Symbol
+	}{
+		{"a", Symbol{Name: "a", Scope: GLOBAL_SCOPE, Index: 0}},
+		{"b", Symbol{Name: "b", Scope: FREE_SCOPE, Index: 0}},
+		{"c", Symbol{Name: "c", Scope: LOCAL_SCOPE, Index: 0}},
+	}
+	for _, testCase := range testCases {
+		symbol, ok := secondLocal.Resolve(testCase.name)
+		if !ok {
+			t.Errorf("Expected %s to resolve", testCase.name)
+			continue
+		}
+		if symbol != testCase.expected {
+			t.Errorf("Expected %+v, received %+v", testCase.expected, symbol)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "b" {
+		t.Errorf("Expected b to be the only free symbol, received %+v", secondLocal.FreeSymbols)
+	}
+	if _, ok := secondLocal.Resolve("d"); ok {
+		t.Errorf("Expected d to be unresolvable")
+	}
+}
@@ -0,0 +1,117 @@
+package compiler
+
+import "github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+
+type SymbolScope string
+
+const (
+	GLOBAL_SCOPE   SymbolScope = "GLOBAL"
+	LOCAL_SCOPE    SymbolScope = "LOCAL"
+	BUILTIN_SCOPE  SymbolScope = "BUILTIN"
+	FREE_SCOPE     SymbolScope = "FREE"
+	FUNCTION_SCOPE SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+type SymbolTable struct {
+	Outer *SymbolTable
+	// Symbols of the enclosing scopes used by this scope, in the order they
+	// are pushed when the closure is created
+	FreeSymbols []Symbol
+
+	store          map[string]Symbol
+	numDefinitions int
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol)}
+}
+
+// NewGlobalSymbolTable creates the top level symbol table with the built-in functions defined
+func NewGlobalSymbolTable() *SymbolTable {
+	symbolTable := NewSymbolTable()
+	for i, name := range evaluator.BuiltinNames() {
+		symbolTable.DefineBuiltin(i, name)
+	}
+	return symbolTable
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	symbolTable := NewSymbolTable()
+	symbolTable.Outer = outer
+	return symbolTable
+}
+
+/*
+Define binds name in the current scope. Redefining a name of the same scope
+reuses its slot, like `let` overwriting a binding in the evaluator.
+*/
+func (s *SymbolTable) Define(name string) Symbol {
+	scope := LOCAL_SCOPE
+	if s.Outer == nil {
+		scope = GLOBAL_SCOPE
+	}
+	if symbol, ok := s.store[name]; ok && symbol.Scope == scope {
+		return symbol
+	}
+	symbol := Symbol{Name: name, Scope: scope, Index: s.numDefinitions}
+	s.store[name] = symbol
+	s.numDefinitions++
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Scope: BUILTIN_SCOPE, Index: index}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName lets a function refer to itself, for recursion
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Scope: FUNCTION_SCOPE, Index: 0}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	symbol := Symbol{Name: original.Name, Scope: FREE_SCOPE, Index: len(s.FreeSymbols) - 1}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+/*
+ResolveBinding resolves the binding an assignment updates. Inside a function
+its own name refers to the binding the function was defined with, so that
+assigning to it is seen outside like in the evaluator.
+*/
+func (s *SymbolTable) ResolveBinding(name string) (Symbol, bool) {
+	symbol, ok := s.Resolve(name)
+	if ok && symbol.Scope == FUNCTION_SCOPE {
+		delete(s.store, name)
+		return s.Resolve(name)
+	}
+	return symbol, ok
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+	if symbol.Scope == GLOBAL_SCOPE || symbol.Scope == BUILTIN_SCOPE {
+		return symbol, ok
+	}
+	// Locals of an enclosing function are captured by the closure
+	return s.defineFree(symbol), true
+}
@@ -0,0 +1,71 @@
+package diagnostic
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+type Severity string
+
+const (
+	ERROR   Severity = "error"
+	WARNING Severity = "warning"
+)
+
+// Code identifies a kind of diagnostic, so tools can match on it without
+// parsing the message
+type Code string
+
+const (
+	UNEXPECTED_TOKEN  Code = "E0001"
+	EXPECTED_EXPR     Code = "E0002"
+	INVALID_INTEGER   Code = "E0003"
+	ILLEGAL_CHARACTER Code = "E0004"
+	INVALID_FLOAT     Code = "E0005"
+	UNTERMINATED_STR  Code = "E0006"
+	INVALID_ESCAPE    Code = "E0007"
+	UNTERMINATED_CMT  Code = "E0008"
+	INVALID_ASSIGN    Code = "E0009"
+	OUTSIDE_LOOP      Code = "E0010"
+)
+
+type Diagnostic struct {
+	Severity Severity          `json:"severity"`
+	Code     Code              `json:"code"`
+	Message  string            `json:"message"`
+	Span     token.Span        `json:"span"`
+	Expected []token.TokenType `json:"expected,omitempty"`
+	Found    token.TokenType   `json:"found,omitempty"`
+	// Optional suggestions on how to fix the problem
+	Hints []string `json:"hints,omitempty"`
+}
+
+func New(code Code, span token.Span, format string, a ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: ERROR,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s[%s]: %s", d.Span.Start, d.Severity, d.Code, d.Message)
+}
+
+func (d Diagnostic) Error() string {
+	return d.String()
+}
+
+// WriteJSON writes diagnostics as a JSON array, for consumption by other tools
+func WriteJSON(w io.Writer, diagnostics []Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
@@ -0,0 +1,89 @@
+package diagnostic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+func TestRender(t *testing.T) {
+	source := "let a = 1;\nlet x = (5;"
+	d := New(UNEXPECTED_TOKEN, token.Span{
+		Start: token.Position{Filename: "test.mk", Offset: 21, Line: 2, Column: 11},
+		End:   token.Position{Filename: "test.mk", Offset: 22, Line: 2, Column: 12},
+	}, "expected next token to be ), got ; instead")
+	d.Hints = []string{`add a closing ")"`}
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := `error[E0001]: expected next token to be ), got ; instead
+ --> test.mk:2:11
+  |
+2 | let x = (5;
+  |           ^
+  = hint: add a closing ")"
+`
+	if out.String() != expected {
+		t.Errorf("Expected:\n%s\nreceived:\n%s", expected, out.String())
+	}
+}
+
+func TestRenderUnderlinesWholeSpan(t *testing.T) {
+	source := "\tfoo bar"
+	d := New(EXPECTED_EXPR, token.Span{
+		Start: token.Position{Line: 1, Column: 6},
+		End:   token.Position{Line: 1, Column: 9},
+	}, "boom")
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "error[E0002]: boom\n --> 1:6\n  |\n1 | \tfoo bar\n  | \t    ^^^\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\nreceived:\n%q", expected, out.String())
+	}
+}
+
+func TestRenderCountsCodePoints(t *testing.T) {
+	source := `"é" @@`
+	d := New(ILLEGAL_CHARACTER, token.Span{
+		Start: token.Position{Line: 1, Column: 5},
+		End:   token.Position{Line: 1, Column: 7},
+	}, "boom")
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "error[E0004]: boom\n --> 1:5\n  |\n1 | \"é\" @@\n  |     ^^\n"
+	if out.String() != expected {
+		t.Errorf("Expected:\n%q\nreceived:\n%q", expected, out.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	d := New(UNEXPECTED_TOKEN, token.Span{
+		Start: token.Position{Line: 1, Column: 5},
+		End:   token.Position{Line: 1, Column: 6},
+	}, "expected next token to be IDENT, got = instead")
+	d.Expected = []token.TokenType{token.IDENT}
+	d.Found = token.ASSIGN
+
+	var out bytes.Buffer
+	if err := WriteJSON(&out, []Diagnostic{d}); err != nil {
+		t.Fatalf("WriteJSON returned error: %v", err)
+	}
+
+	var decoded []Diagnostic
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatalf("could not decode output %q: %v", out.String(), err)
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("Expected 1 diagnostic, received %d", len(decoded))
+	}
+	if decoded[0].Code != UNEXPECTED_TOKEN || decoded[0].Found != token.ASSIGN || decoded[0].Span.Start.Column != 5 {
+		t.Errorf("Diagnostic did not round trip, received %+v", decoded[0])
+	}
+}
@@ -0,0 +1,91 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Render prints a diagnostic together with the offending source line, e.g.
+
+	error[E0001]: expected next token to be ), got ; instead
+	 --> script.mk:1:11
+	  |
+	1 | let x = (5;
+	  |           ^
+	  = hint: add a closing ")"
+*/
+func Render(w io.Writer, source string, d Diagnostic) {
+	fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	start := d.Span.Start
+	if !start.IsValid() {
+		renderHints(w, "", d.Hints)
+		return
+	}
+	line, ok := sourceLine(source, start.Line)
+	gutter := strings.Repeat(" ", len(strconv.Itoa(start.Line)))
+	fmt.Fprintf(w, "%s--> %s\n", gutter, start)
+	if ok {
+		fmt.Fprintf(w, "%s |\n", gutter)
+		fmt.Fprintf(w, "%d | %s\n", start.Line, line)
+		fmt.Fprintf(w, "%s | %s%s\n", gutter, caretPadding(line, start.Column), strings.Repeat("^", caretWidth(d, line)))
+	}
+	renderHints(w, gutter, d.Hints)
+}
+
+// RenderAll renders every diagnostic, separated by blank lines
+func RenderAll(w io.Writer, source string, diagnostics []Diagnostic) {
+	for i, d := range diagnostics {
+		if i > 0 {
+			io.WriteString(w, "\n")
+		}
+		Render(w, source, d)
+	}
+}
+
+func renderHints(w io.Writer, gutter string, hints []string) {
+	for _, hint := range hints {
+		fmt.Fprintf(w, "%s = hint: %s\n", gutter, hint)
+	}
+}
+
+func sourceLine(source string, line int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	return strings.TrimRight(lines[line-1], "\r"), true
+}
+
+// caretPadding keeps tabs from the source line so the caret lines up with the column
+func caretPadding(line string, column int) string {
+	var out strings.Builder
+	chars := []rune(line)
+	for i := 0; i < column-1 && i < len(chars); i++ {
+		if chars[i] == '\t' {
+			out.WriteByte('\t')
+		} else {
+			out.WriteByte(' ')
+		}
+	}
+	return out.String()
+}
+
+// caretWidth underlines the span, or a single char when the span continues on later lines
+func caretWidth(d Diagnostic, line string) int {
+	start, end := d.Span.Start, d.Span.End
+	width := 1
+	if end.Line == start.Line && end.Column > start.Column {
+		width = end.Column - start.Column
+	} else if length := utf8.RuneCountInString(line); end.Line > start.Line && length >= start.Column {
+		width = length - start.Column + 1
+	}
+	if width < 1 {
+		width = 1
+	}
+	return width
+}
@@ -0,0 +1,298 @@
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+)
+
+// Builtins of arrays calling functions, they stop at the first error the function returns
+
+// ArrayBuiltins returns map, filter, reduce and the other builtins calling functions on arrays
+func ArrayBuiltins() *object.Registry {
+	registry := object.NewRegistry()
+	array := object.Param{Name: "array", Types: []object.ObjectType{object.ARRAY_OBJ}}
+	function := object.Param{Name: "fn", Types: []object.ObjectType{object.FUNCTION_OBJ, object.BULITIN_OBJ}}
+	register := func(name string, fn object.CallerFunction, doc string) {
+		registry.Register(object.BuiltinSpec{
+			Name:    name,
+			BuiltIn: &object.BuiltIn{CallerFn: fn},
+			Arity:   2,
+			Params:  []object.Param{array, function},
+			Doc:     doc,
+		})
+	}
+	register("map", mapBuiltIn, "Returns the results of fn(element) for each element")
+	register("filter", filterBuiltIn, "Returns the elements for which fn(element) is truthy")
+	register("each", eachBuiltIn, "Calls fn(element) for each element and returns null")
+	register("find", findBuiltIn, "Returns the first element for which fn(element) is truthy, null when there is none")
+	register("any", anyBuiltIn, "Reports whether fn(element) is truthy for any element")
+	register("all", allBuiltIn, "Reports whether fn(element) is truthy for all elements")
+	register("flat_map", flatMapBuiltIn, "Concatenates the arrays returned by fn(element)")
+	register("sort_by", sortByBuiltIn, "Returns the elements ordered by fn(element), equal keys keep their order")
+	register("group_by", groupByBuiltIn, "Returns a hash from each fn(element) to the elements it was returned for")
+	registry.Register(object.BuiltinSpec{
+		Name:    "reduce",
+		BuiltIn: &object.BuiltIn{CallerFn: reduceBuiltIn},
+		Arity:   object.VARIADIC,
+		Params:  []object.Param{array, function, {Name: "initial"}},
+		Doc:     "Combines the elements with fn(accumulator, element), starting from initial or the first element",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "zip",
+		BuiltIn: &object.BuiltIn{Fn: zipBuiltIn},
+		Arity:   object.VARIADIC,
+		Params:  []object.Param{array},
+		Doc:     "Returns arrays of the elements at the same index, as long as the shortest array",
+	})
+	return registry
+}
+
+var mapBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("map", args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := make([]object.Object, len(array.Elements))
+	for i, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		elements[i] = result
+	}
+	return &object.Array{Elements: elements}
+}
+
+var filterBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("filter", args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := []object.Object{}
+	for _, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			elements = append(elements, element)
+		}
+	}
+	return &object.Array{Elements: elements}
+}
+
+var reduceBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	if len(args) != 2 && len(args) != 3 {
+		return object.NewError("wrong number of arguments: received %d, expected 2 or 3", len(args))
+	}
+	array, errObj := validateArrayAndFunctionArgs("reduce", args[:2]...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := array.Elements
+	var accumulator object.Object
+	if len(args) == 3 {
+		accumulator = args[2]
+	} else {
+		if len(elements) == 0 {
+			return object.NewError("`reduce` of an empty array without an initial value")
+		}
+		accumulator, elements = elements[0], elements[1:]
+	}
+	for _, element := range elements {
+		accumulator = caller.Call(args[1], accumulator, element)
+		if isError(accumulator) {
+			return accumulator
+		}
+	}
+	return accumulator
+}
+
+var eachBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("each", args...)
+	if errObj != nil {
+		return errObj
+	}
+	for _, element := range array.Elements {
+		if result := caller.Call(args[1], element); isError(result) {
+			return result
+		}
+	}
+	return NULL
+}
+
+var findBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("find", args...)
+	if errObj != nil {
+		return errObj
+	}
+	for _, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			return element
+		}
+	}
+	return NULL
+}
+
+var anyBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("any", args...)
+	if errObj != nil {
+		return errObj
+	}
+	for _, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		if isTruthy(result) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+var allBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("all", args...)
+	if errObj != nil {
+		return errObj
+	}
+	for _, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		if !isTruthy(result) {
+			return FALSE
+		}
+	}
+	return TRUE
+}
+
+var flatMapBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("flat_map", args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := []object.Object{}
+	for _, element := range array.Elements {
+		result := caller.Call(args[1], element)
+		if isError(result) {
+			return result
+		}
+		resultArray, ok := result.(*object.Array)
+		if !ok {
+			return object.NewError("function passed to `flat_map` must return ARRAY, received %s", result.Type())
+		}
+		elements = append(elements, resultArray.Elements...)
+	}
+	return &object.Array{Elements: elements}
+}
+
+// sortByBuiltIn compares the keys with `<`, so they must be all numbers or all strings
+var sortByBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("sort_by", args...)
+	if errObj != nil {
+		return errObj
+	}
+	keys := make([]object.Object, len(array.Elements))
+	for i, element := range array.Elements {
+		keys[i] = caller.Call(args[1], element)
+		if isError(keys[i]) {
+			return keys[i]
+		}
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	var compareErr object.Object
+	sort.SliceStable(order, func(i, j int) bool {
+		if compareErr != nil {
+			return false
+		}
+		result := evalInfixExpression("<", keys[order[i]], keys[order[j]])
+		if isError(result) {
+			compareErr = result
+			return false
+		}
+		return isTruthy(result)
+	})
+	if compareErr != nil {
+		return compareErr
+	}
+
+	elements := make([]object.Object, len(order))
+	for i, index := range order {
+		elements[i] = array.Elements[index]
+	}
+	return &object.Array{Elements: elements}
+}
+
+var groupByBuiltIn object.CallerFunction = func(caller object.Caller, args ...object.Object) object.Object {
+	array, errObj := validateArrayAndFunctionArgs("group_by", args...)
+	if errObj != nil {
+		return errObj
+	}
+	groups := object.NewHash()
+	for _, element := range array.Elements {
+		key := caller.Call(args[1], element)
+		if isError(key) {
+			return key
+		}
+		group, ok := groups.Get(key)
+		if !ok {
+			group = &object.Array{}
+			if errObj := groups.Set(key, group); errObj != nil {
+				return errObj
+			}
+		}
+		group.(*object.Array).Elements = append(group.(*object.Array).Elements, element)
+	}
+	return groups
+}
+
+var zipBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return object.NewError("wrong number of arguments: received 0, expected at least 1")
+	}
+	length := -1
+	for _, arg := range args {
+		array, ok := arg.(*object.Array)
+		if !ok {
+			return object.NewError("argument to `zip` must be ARRAY, received %s", arg.Type())
+		}
+		if length == -1 || len(array.Elements) < length {
+			length = len(array.Elements)
+		}
+	}
+	elements := make([]object.Object, length)
+	for i := range elements {
+		tuple := make([]object.Object, len(args))
+		for j, arg := range args {
+			tuple[j] = arg.(*object.Array).Elements[i]
+		}
+		elements[i] = &object.Array{Elements: tuple}
+	}
+	return &object.Array{Elements: elements}
+}
+
+func validateArrayAndFunctionArgs(fnName string, args ...object.Object) (*object.Array, object.Object) {
+	if err := validateArgsLen(2, args...); err != nil {
+		return nil, err
+	}
+	if err := validateArrayArgs(fnName, args...); err != nil {
+		return nil, err
+	}
+	switch args[1].(type) {
+	case *object.Function, *object.BuiltIn, *object.Closure:
+		return args[0].(*object.Array), nil
+	default:
+		return nil, object.NewError("second argument to `%s` must be FUNCTION, received %s", fnName, args[1].Type())
+	}
+}
@@ -1,30 +1,121 @@
 package evaluator
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/zawlinnnaing/monkey-language-in-golang/object"
 )
 
-var builtInEnvironment = map[string]*object.BuiltIn{
-	"len": {
-		Fn: lenBuiltIn,
-	},
-	"first": {
-		Fn: firstBuiltIn,
-	},
-	"last": {
-		Fn: lastBuiltIn,
-	},
-	"rest": {
-		Fn: restBuiltIn,
-	},
-	"push": {
-		Fn: pushBuiltIn,
-	},
-	"print": {
-		Fn: printBuiltIn,
-	},
+// Builtins of the evaluator when the environment has no registry, also used by the vm
+var defaultBuiltins = DefaultBuiltins()
+
+// DefaultBuiltins returns the core builtins and the io builtins on os.Stdout and os.Stdin
+func DefaultBuiltins() *object.Registry {
+	return object.NewRegistry(CoreBuiltins(), IOBuiltins(os.Stdout, os.Stdin))
+}
+
+// CoreBuiltins returns the builtins without side effects, including ArrayBuiltins and HashBuiltins
+func CoreBuiltins() *object.Registry {
+	registry := object.NewRegistry()
+	anyValue := []object.Param{{Name: "value"}}
+	array := []object.Param{{Name: "array", Types: []object.ObjectType{object.ARRAY_OBJ}}}
+	registry.Register(object.BuiltinSpec{
+		Name:    "len",
+		BuiltIn: &object.BuiltIn{Fn: lenBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{{Name: "value", Types: []object.ObjectType{object.STRING_OBJ, object.ARRAY_OBJ, object.HASH_OBJ}}},
+		Doc:     "Returns the number of characters of a string, elements of an array or pairs of a hash",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "first",
+		BuiltIn: &object.BuiltIn{Fn: firstBuiltIn},
+		Arity:   1,
+		Params:  array,
+		Doc:     "Returns the first element of an array, null when it is empty",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "last",
+		BuiltIn: &object.BuiltIn{Fn: lastBuiltIn},
+		Arity:   1,
+		Params:  array,
+		Doc:     "Returns the last element of an array, null when it is empty",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "rest",
+		BuiltIn: &object.BuiltIn{Fn: restBuiltIn},
+		Arity:   1,
+		Params:  array,
+		Doc:     "Returns a new array without the first element, null when it is empty",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "push",
+		BuiltIn: &object.BuiltIn{Fn: pushBuiltIn},
+		Arity:   2,
+		Params:  []object.Param{array[0], {Name: "value"}},
+		Doc:     "Returns a new array with value appended",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "int",
+		BuiltIn: &object.BuiltIn{Fn: intBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{{Name: "value", Types: []object.ObjectType{object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ}}},
+		Doc:     "Converts to an integer, floats are truncated towards zero",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "float",
+		BuiltIn: &object.BuiltIn{Fn: floatBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{{Name: "value", Types: []object.ObjectType{object.INTEGER_OBJ, object.FLOAT_OBJ, object.STRING_OBJ}}},
+		Doc:     "Converts to a float",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "str",
+		BuiltIn: &object.BuiltIn{Fn: strBuiltIn},
+		Arity:   1,
+		Params:  anyValue,
+		Doc:     "Converts to a string",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "chars",
+		BuiltIn: &object.BuiltIn{Fn: charsBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{{Name: "value", Types: []object.ObjectType{object.STRING_OBJ}}},
+		Doc:     "Splits a string into an array of one character strings",
+	})
+	return object.NewRegistry(registry, ArrayBuiltins(), HashBuiltins())
+}
+
+// IOBuiltins returns `print` writing to out and `input` reading from in
+func IOBuiltins(out io.Writer, in io.Reader) *object.Registry {
+	registry := object.NewRegistry()
+	registry.Register(object.BuiltinSpec{
+		Name:    "print",
+		BuiltIn: NewPrintBuiltIn(out),
+		Arity:   object.VARIADIC,
+		Doc:     "Prints each argument on its own line",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "input",
+		BuiltIn: NewInputBuiltIn(in),
+		Arity:   0,
+		Doc:     "Reads a line, null at the end of the input",
+	})
+	return registry
+}
+
+// builtinsOf returns the registry attached to env, or the default builtins
+func builtinsOf(env *object.Environment) *object.Registry {
+	if registry := env.Registry(); registry != nil {
+		return registry
+	}
+	return defaultBuiltins
 }
 
 var lenBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
@@ -34,12 +125,15 @@ var lenBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Objec
 	switch arg := args[0].(type) {
 	case *object.String:
 		{
-			return &object.Integer{Value: int64(len(arg.Value))}
+			// Characters, not bytes
+			return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 		}
 	case *object.Array:
 		{
 			return &object.Integer{Value: int64(len(arg.Elements))}
 		}
+	case *object.Hash:
+		return &object.Integer{Value: int64(arg.Len())}
 	default:
 		return object.NewError("argument to `len` not supported, received %s", arg.Type())
 	}
@@ -90,8 +184,8 @@ var restBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Obje
 	if len(arr.Elements) == 0 {
 		return NULL
 	}
-	newArray := &object.Array{}
-	copy(arr.Elements[1:len(arr.Elements)], newArray.Elements)
+	newArray := &object.Array{Elements: make([]object.Object, len(arr.Elements)-1)}
+	copy(newArray.Elements, arr.Elements[1:])
 	return newArray
 }
 
@@ -108,19 +202,114 @@ var pushBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Obje
 	newArray := &object.Array{}
 	arrLen := len(array.Elements)
 	newArray.Elements = make([]object.Object, arrLen+1)
-	copy(array.Elements, newArray.Elements)
+	copy(newArray.Elements, array.Elements)
 	newArray.Elements[arrLen] = args[1]
 	return newArray
 }
 
-var printBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
-	for _, arg := range args {
-		fmt.Println(arg.Inspect())
+// NewPrintBuiltIn creates a `print` writing each argument on its own line to out
+func NewPrintBuiltIn(out io.Writer) *object.BuiltIn {
+	return &object.BuiltIn{Fn: func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			fmt.Fprintln(out, arg.Inspect())
+		}
+		return NULL
+	}}
+}
+
+// NewInputBuiltIn creates an `input` reading a line from in, it returns null at the end of the input
+func NewInputBuiltIn(in io.Reader) *object.BuiltIn {
+	reader := bufio.NewReader(in)
+	return &object.BuiltIn{Fn: func(args ...object.Object) object.Object {
+		if err := validateArgsLen(0, args...); err != nil {
+			return err
+		}
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return NULL
+		}
+		if err != nil && err != io.EOF {
+			return object.NewError("could not read input: %s", err)
+		}
+		return &object.String{Value: strings.TrimRight(line, "\r\n")}
+	}}
+}
+
+// intBuiltIn converts to an integer, floats are truncated towards zero
+var intBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if err := validateArgsLen(1, args...); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return arg
+	case *object.Float:
+		truncated := math.Trunc(arg.Value)
+		if math.IsNaN(truncated) || truncated < math.MinInt64 || truncated >= math.MaxInt64 {
+			return object.NewError("could not convert %s to INTEGER", arg.Inspect())
+		}
+		return &object.Integer{Value: int64(truncated)}
+	case *object.String:
+		value, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err != nil {
+			return object.NewError("could not convert %q to INTEGER", arg.Value)
+		}
+		return &object.Integer{Value: value}
+	default:
+		return object.NewError("argument to `int` not supported, received %s", arg.Type())
+	}
+}
+
+var floatBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if err := validateArgsLen(1, args...); err != nil {
+		return err
+	}
+	switch arg := args[0].(type) {
+	case *object.Integer:
+		return &object.Float{Value: float64(arg.Value)}
+	case *object.Float:
+		return arg
+	case *object.String:
+		value, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil {
+			return object.NewError("could not convert %q to FLOAT", arg.Value)
+		}
+		return &object.Float{Value: value}
+	default:
+		return object.NewError("argument to `float` not supported, received %s", arg.Type())
 	}
-	return NULL
+}
+
+var strBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if err := validateArgsLen(1, args...); err != nil {
+		return err
+	}
+	if str, ok := args[0].(*object.String); ok {
+		return str
+	}
+	return &object.String{Value: args[0].Inspect()}
+}
+
+// charsBuiltIn splits a string into an array of one character strings
+var charsBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if err := validateArgsLen(1, args...); err != nil {
+		return err
+	}
+	str, ok := args[0].(*object.String)
+	if !ok {
+		return object.NewError("argument to `chars` must be STRING, received %s", args[0].Type())
+	}
+	elements := []object.Object{}
+	for _, char := range str.Value {
+		elements = append(elements, &object.String{Value: string(char)})
+	}
+	return &object.Array{Elements: elements}
 }
 
 func validateArrayArgs(fnName string, args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return object.NewError("wrong number of arguments: received 0, expected at least 1")
+	}
 	if args[0].Type() != object.ARRAY_OBJ {
 		return object.NewError("argument to `%s` must be ARRAY, received %s", fnName, args[0].Type())
 	}
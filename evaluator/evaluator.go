@@ -1,17 +1,80 @@
 package evaluator
 
 import (
+	"cmp"
+	"context"
+	"math"
+	"strings"
+
 	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
 	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
 )
 
 var (
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
-	NULL  = &object.Null{}
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+	NULL  = object.NULL
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	// A bug in the interpreter or a builtin must not bring the host process down,
+	// the innermost node turns the panic into a runtime error at its position
+	defer func() {
+		if r := recover(); r != nil {
+			errObj := object.NewError("internal error: %v", r)
+			if node != nil {
+				errObj.Pos = errorPosition(node)
+			}
+			result = errObj
+		}
+	}()
+	if errObj := env.Runtime().Step(); errObj != nil {
+		result = errObj
+	} else {
+		result = eval(node, env)
+	}
+	// The innermost node an error comes out of is where it happened
+	if errObj, ok := result.(*object.Error); ok && !errObj.Pos.IsValid() && node != nil {
+		errObj.Pos = errorPosition(node)
+	}
+	return result
+}
+
+/*
+EvalContext evaluates node within limits, e.g. for untrusted programs. The
+evaluation stops with an error once a limit is exceeded or ctx is done.
+Functions defined by earlier evaluations in env run within the new limits.
+*/
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) object.Object {
+	previous := env.Runtime()
+	env.SetRuntime(object.NewRuntime(ctx, limits))
+	defer env.SetRuntime(previous)
+	return Eval(node, env)
+}
+
+// allocate counts a newly created object towards the allocation limit
+func allocate(env *object.Environment, obj object.Object) object.Object {
+	if errObj := env.Runtime().Allocate(object.AllocationSize(obj)); errObj != nil {
+		return errObj
+	}
+	return obj
+}
+
+func errorPosition(node ast.Node) token.Position {
+	switch n := node.(type) {
+	case *ast.InfixExpression:
+		// Point at the operator rather than the left operand
+		return n.Token.Pos
+	default:
+		return node.Span().Start
+	}
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch n := node.(type) {
 	case *ast.Program:
 		return evalProgram(n, env)
@@ -21,30 +84,36 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(n.Expression, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: n.Value}
+	case *ast.FloatLiteral:
+		return &object.Float{Value: n.Value}
 	case *ast.BooleanLiteral:
 		return evalBooleanLiteral(n)
 	case *ast.StringLiteral:
-		return &object.String{Value: n.Value}
+		return allocate(env, &object.String{Value: n.Value})
 	case *ast.HashLiteral:
-		return evalHashLiteral(n, env)
+		return allocate(env, evalHashLiteral(n, env))
 	case *ast.LetStatement:
 		return evalLetStatement(n, env)
 	case *ast.PrefixExpression:
 		right := Eval(n.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(n.Operator, right)
 	case *ast.InfixExpression:
+		if n.Operator == "&&" || n.Operator == "||" {
+			return evalLogicalExpression(n, env)
+		}
 		left := Eval(n.Left, env)
-		right := Eval(n.Right, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
-		if isError(right) {
+		right := Eval(n.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
-		return evalInfixExpression(n.Operator, left, right)
+		// Concatenation creates strings
+		return allocate(env, evalInfixExpression(n.Operator, left, right))
 	case *ast.IfExpression:
 		return evalIfExpression(n, env)
 	case *ast.BlockStatement:
@@ -55,34 +124,50 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalCallExpression(n, env)
 	case *ast.ReturnStatement:
 		val := Eval(n.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(n.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
-		return &object.Array{Elements: elements}
+		return allocate(env, &object.Array{Elements: elements})
 	case *ast.IndexExpression:
 		return evalIndexExpression(n, env)
+	case *ast.AssignExpression:
+		return evalAssignExpression(n, env)
+	case *ast.WhileStatement:
+		return evalWhileStatement(n, env)
+	case *ast.ForStatement:
+		return evalForStatement(n, env)
+	case *ast.BreakStatement:
+		return BREAK
+	case *ast.ContinueStatement:
+		return CONTINUE
 	}
 	return nil
 }
 
 func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) object.Object {
 	left := Eval(node.Left, env)
-	if isError(left) {
+	if isAbrupt(left) {
 		return left
 	}
 	right := Eval(node.Index, env)
-	if isError(right) {
+	if isAbrupt(right) {
 		return right
 	}
+	return evalIndexOperation(left, right)
+}
+
+func evalIndexOperation(left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, right)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, right)
 	default:
@@ -101,17 +186,25 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObj.Elements[idx]
 }
 
+// evalStringIndexExpression indexes code points, the result is a one character string
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	if idx < 0 || idx >= int64(len(chars)) {
+		return NULL
+	}
+	return &object.String{Value: string(chars[idx])}
+}
+
 func evalHashIndexExpression(hashLiteral, index object.Object) object.Object {
-	hashableIndex, ok := index.(object.Hashable)
-	if !ok {
+	if _, ok := index.(object.Hashable); !ok {
 		return object.NewError("unusable as hash key: %s", index.Type())
 	}
-	hashNode := hashLiteral.(*object.Hash)
-	hashPair, ok := hashNode.Pairs[hashableIndex.HashKey()]
+	value, ok := hashLiteral.(*object.Hash).Get(index)
 	if !ok {
 		return NULL
 	}
-	return hashPair.Value
+	return value
 }
 
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
@@ -119,7 +212,7 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	if ok {
 		return val
 	}
-	builtInObj, ok := builtInEnvironment[node.Value]
+	builtInObj, ok := builtinsOf(env).Lookup(node.Value)
 	if ok {
 		return builtInObj
 	}
@@ -128,16 +221,192 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 
 func evalLetStatement(node *ast.LetStatement, env *object.Environment) object.Object {
 	val := Eval(node.Value, env)
-	if isError(val) {
+	if isAbrupt(val) {
 		return val
 	}
 	env.Set(node.Name.Value, val)
 	return NULL
 }
 
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	if target, ok := node.Target.(*ast.IndexExpression); ok {
+		return evalIndexAssignExpression(node, target, env)
+	}
+
+	name := node.Target.(*ast.Identifier).Value
+	current, ok := env.Get(name)
+	if !ok {
+		return object.NewError("cannot assign to undeclared identifier: %s", name)
+	}
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	if operator := compoundOperator(node.Operator); operator != "" {
+		val = allocate(env, evalInfixExpression(operator, current, val))
+		if isError(val) {
+			return val
+		}
+	}
+	env.Assign(name, val)
+	return val
+}
+
+func evalIndexAssignExpression(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Environment) object.Object {
+	container := Eval(target.Left, env)
+	if isAbrupt(container) {
+		return container
+	}
+	index := Eval(target.Index, env)
+	if isAbrupt(index) {
+		return index
+	}
+	operator := compoundOperator(node.Operator)
+	var current object.Object
+	if operator != "" {
+		current = evalIndexOperation(container, index)
+		if isError(current) {
+			return current
+		}
+	}
+	val := Eval(node.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
+	if operator != "" {
+		val = allocate(env, evalInfixExpression(operator, current, val))
+		if isError(val) {
+			return val
+		}
+	}
+	// Adding a pair grows a hash
+	size := object.AllocationSize(container)
+	result := evalIndexAssignment(container, index, val)
+	if isError(result) {
+		return result
+	}
+	if errObj := env.Runtime().Allocate(object.AllocationSize(container) - size); errObj != nil {
+		return errObj
+	}
+	return result
+}
+
+/*
+evalIndexAssignment sets an element of an array or a hash in place, every
+binding referring to the same array or hash sees the change. Arrays don't
+grow, writing out of their range is an error.
+*/
+func evalIndexAssignment(container, index, val object.Object) object.Object {
+	switch container := container.(type) {
+	case *object.Array:
+		integer, ok := index.(*object.Integer)
+		if !ok {
+			return object.NewError("index operator not supported: %s", index.Type())
+		}
+		if integer.Value < 0 || integer.Value >= int64(len(container.Elements)) {
+			return object.NewError("index out of range: %d (length %d)", integer.Value, len(container.Elements))
+		}
+		container.Elements[integer.Value] = val
+		return val
+	case *object.Hash:
+		if errObj := container.Set(index, val); errObj != nil {
+			return errObj
+		}
+		return val
+	default:
+		return object.NewError("index assignment not supported: %s", container.Type())
+	}
+}
+
+// compoundOperator returns the infix operator of a compound assignment, e.g.
+// "+" for "+=", or "" for a plain assignment
+func compoundOperator(assignOperator string) string {
+	if assignOperator == "=" {
+		return ""
+	}
+	return strings.TrimSuffix(assignOperator, "=")
+}
+
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+}
+
+// evalForStatement binds the loop variable in the enclosing scope, like a let statement
+func evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := Eval(node.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+	elements, err := iterate(iterable)
+	if err != nil {
+		return err
+	}
+	for _, element := range elements {
+		env.Set(node.Variable.Value, element)
+		if result, done := evalLoopBody(node.Body, env); done {
+			return result
+		}
+	}
+	return NULL
+}
+
+// evalLoopBody runs one iteration, it reports whether the loop is done and its result
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+	if result == nil {
+		return nil, false
+	}
+	switch result.Type() {
+	case object.BREAK_OBJ:
+		return NULL, true
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+		return result, true
+	}
+	return nil, false
+}
+
+/*
+iterate returns the values a for loop goes over: the elements of an array,
+the keys of a hash or the characters of a string. The values are taken when
+the loop starts, changes made by the loop body don't affect the iteration.
+*/
+func iterate(iterable object.Object) ([]object.Object, *object.Error) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements := make([]object.Object, len(iterable.Elements))
+		copy(elements, iterable.Elements)
+		return elements, nil
+	case *object.Hash:
+		keys := make([]object.Object, 0, iterable.Len())
+		for _, pair := range iterable.Pairs() {
+			keys = append(keys, pair.Key)
+		}
+		return keys, nil
+	case *object.String:
+		chars := []object.Object{}
+		for _, char := range iterable.Value {
+			chars = append(chars, &object.String{Value: string(char)})
+		}
+		return chars, nil
+	default:
+		return nil, object.NewError("cannot iterate over %s", iterable.Type())
+	}
+}
+
 func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(node.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -148,16 +417,38 @@ func evalIfExpression(node *ast.IfExpression, env *object.Environment) object.Ob
 	return NULL
 }
 
+/*
+evalLogicalExpression only evaluates the right operand when the left one
+doesn't decide the result. The result is the deciding operand itself, e.g.
+`null || "default"` is "default".
+*/
+func evalLogicalExpression(node *ast.InfixExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
+	}
+	if isTruthy(left) == (node.Operator == "||") {
+		return left
+	}
+	return Eval(node.Right, env)
+}
+
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		// At least one float, integers are promoted
+		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case isNumber(left) && right.Type() == object.STRING_OBJ, left.Type() == object.STRING_OBJ && isNumber(right):
+		// A number never equals a string, comparing them is a mistake rather than false
+		return object.NewError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	case operator == "==":
-		return object.NewBoolean(left == right)
+		return nativeBoolToBooleanObject(object.Equal(left, right))
 	case operator == "!=":
-		return object.NewBoolean(left != right)
+		return nativeBoolToBooleanObject(!object.Equal(left, right))
 	case left.Type() != right.Type():
 		return object.NewError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
 	default:
@@ -166,28 +457,76 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 
 }
 
+// evalStringInfixExpression compares strings by code point, which is the byte order of UTF-8
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	// TODO: add support for string comparison
-	if operator != "+" {
-		return object.NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	default:
+		return object.NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
+	case "+", "-", "*", "**":
+		if operator == "**" && rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		result, ok := integerArithmetic(operator, leftVal, rightVal)
+		if !ok {
+			return object.NewError("integer overflow: %d %s %d", leftVal, operator, rightVal)
+		}
+		return &object.Integer{Value: result}
+	case "/", "%":
+		if rightVal == 0 {
+			return object.NewError("division by zero")
+		}
+		if operator == "%" {
+			return &object.Integer{Value: leftVal % rightVal}
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return object.NewError("integer overflow: %d / %d", leftVal, rightVal)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		if rightVal < 0 {
+			return object.NewError("negative shift count: %d", rightVal)
+		}
+		if rightVal >= 64 {
+			return object.NewError("shift count too large: %d", rightVal)
+		}
+		if operator == "<<" {
+			// Like multiplying by a power of two, losing bits is an overflow
+			result := leftVal << rightVal
+			if result>>rightVal != leftVal {
+				return object.NewError("integer overflow: %d << %d", leftVal, rightVal)
+			}
+			return &object.Integer{Value: result}
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
 		if leftVal < rightVal {
 			return TRUE
@@ -223,6 +562,155 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+// integerArithmetic reports false when the result doesn't fit in an int64
+func integerArithmetic(operator string, left, right int64) (int64, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		// Overflow wraps around, giving a result on the wrong side of left
+		return result, (result > left) == (right > 0)
+	case "-":
+		result := left - right
+		return result, (result < left) == (right > 0)
+	case "*":
+		return multiplyIntegers(left, right)
+	default:
+		return integerPower(left, right)
+	}
+}
+
+func multiplyIntegers(left, right int64) (int64, bool) {
+	if left == 0 || right == 0 {
+		return 0, true
+	}
+	result := left * right
+	if result/right != left || (left == -1 && right == math.MinInt64) || (right == -1 && left == math.MinInt64) {
+		return 0, false
+	}
+	return result, true
+}
+
+// integerPower computes base ** exponent by squaring, exponent must not be negative
+func integerPower(base, exponent int64) (int64, bool) {
+	result := int64(1)
+	for exponent > 0 {
+		var ok bool
+		if exponent&1 == 1 {
+			if result, ok = multiplyIntegers(result, base); !ok {
+				return 0, false
+			}
+		}
+		exponent >>= 1
+		if exponent > 0 {
+			if base, ok = multiplyIntegers(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<", ">", "==", "!=", ">=", "<=":
+		comparison, ordered := compareNumbers(left, right)
+		switch operator {
+		case "<":
+			return nativeBoolToBooleanObject(ordered && comparison < 0)
+		case ">":
+			return nativeBoolToBooleanObject(ordered && comparison > 0)
+		case "==":
+			return nativeBoolToBooleanObject(ordered && comparison == 0)
+		case "!=":
+			return nativeBoolToBooleanObject(!ordered || comparison != 0)
+		case ">=":
+			return nativeBoolToBooleanObject(ordered && comparison >= 0)
+		default:
+			return nativeBoolToBooleanObject(ordered && comparison <= 0)
+		}
+	default:
+		return object.NewError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+/*
+compareNumbers returns -1, 0 or 1 as left is less than, equal to or greater
+than right, ordered is false for NaN. Integers are compared with floats
+exactly rather than rounded to a float64, like object.Equal and hash keys do.
+*/
+func compareNumbers(left, right object.Object) (comparison int, ordered bool) {
+	if integer, ok := left.(*object.Integer); ok {
+		if float, ok := right.(*object.Float); ok {
+			return compareIntegerFloat(integer.Value, float.Value)
+		}
+	}
+	if float, ok := left.(*object.Float); ok {
+		if integer, ok := right.(*object.Integer); ok {
+			comparison, ordered := compareIntegerFloat(integer.Value, float.Value)
+			return -comparison, ordered
+		}
+	}
+	return compareFloats(toFloat(left), toFloat(right))
+}
+
+func compareIntegerFloat(integer int64, float float64) (int, bool) {
+	switch {
+	case math.IsNaN(float):
+		return 0, false
+	case float >= math.MaxInt64:
+		// The float64 nearest to MaxInt64 is 2^63, above every integer
+		return -1, true
+	case float < math.MinInt64:
+		return 1, true
+	}
+	truncated := math.Trunc(float)
+	if integer != int64(truncated) {
+		return cmp.Compare(integer, int64(truncated)), true
+	}
+	// Same integral part, the fraction decides
+	return compareFloats(truncated, float)
+}
+
+func compareFloats(left, right float64) (int, bool) {
+	if math.IsNaN(left) || math.IsNaN(right) {
+		return 0, false
+	}
+	return cmp.Compare(left, right), true
+}
+
+func isNumber(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.FLOAT_OBJ
+}
+
+// toFloat converts an integer or a float object to a float64
+func toFloat(obj object.Object) float64 {
+	if integer, ok := obj.(*object.Integer); ok {
+		return float64(integer.Value)
+	}
+	return obj.(*object.Float).Value
+}
+
+func nativeBoolToBooleanObject(value bool) *object.Boolean {
+	if value {
+		return TRUE
+	}
+	return FALSE
+}
+
 func evalBooleanLiteral(node *ast.BooleanLiteral) object.Object {
 	if node.Value {
 		return TRUE
@@ -231,27 +719,23 @@ func evalBooleanLiteral(node *ast.BooleanLiteral) object.Object {
 }
 
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
 			return key
 		}
-		hashableKey, ok := key.(object.Hashable)
-		if !ok {
+		if _, ok := key.(object.Hashable); !ok {
 			return object.NewError("unusable as hash key: %s", key.Type())
 		}
-		hashed := hashableKey.HashKey()
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
 			return value
 		}
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
-	}
-	return &object.Hash{
-		Pairs: pairs,
+		hash.Set(key, value)
 	}
+	return hash
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
@@ -269,12 +753,14 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 }
 
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
-	var result object.Object
+	// Empty blocks are null, like in the vm
+	var result object.Object = NULL
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
 		if result != nil {
 			resultType := result.Type()
-			if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ {
+			if resultType == object.RETURN_VALUE_OBJ || resultType == object.ERROR_OBJ ||
+				resultType == object.BREAK_OBJ || resultType == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -288,26 +774,37 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "~":
+		integer, ok := right.(*object.Integer)
+		if !ok {
+			return object.NewError("unknown operator: ~%s", right.Type())
+		}
+		return &object.Integer{Value: ^integer.Value}
 	default:
 		return object.NewError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	integer, ok := right.(*object.Integer)
-	if !ok {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			return object.NewError("integer overflow: -(%d)", right.Value)
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return object.NewError("unknown operator: -%s", right.Type())
 	}
-	return &object.Integer{Value: -integer.Value}
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
-	integer, ok := right.(*object.Integer)
-	if ok {
-		if integer.Value == 0 {
-			return TRUE
-		}
-		return FALSE
+	switch number := right.(type) {
+	case *object.Integer:
+		return nativeBoolToBooleanObject(number.Value == 0)
+	case *object.Float:
+		return nativeBoolToBooleanObject(number.Value == 0)
 	}
 	switch right {
 	case TRUE:
@@ -323,6 +820,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalFunctionLiteral(node *ast.FunctionLiteral, env *object.Environment) *object.Function {
 	return &object.Function{
+		Name:       node.Name,
 		Parameters: node.Parameters,
 		Body:       node.Body,
 		Env:        env,
@@ -331,30 +829,88 @@ func evalFunctionLiteral(node *ast.FunctionLiteral, env *object.Environment) *ob
 
 func evalCallExpression(node *ast.CallExpression, env *object.Environment) object.Object {
 	evaluated := Eval(node.Function, env)
-	if isError(evaluated) {
+	if isAbrupt(evaluated) {
 		return evaluated
 	}
 
 	evaluatedArgs := evalExpressions(node.Arguments, env)
-	if len(evaluatedArgs) == 1 && isError(evaluatedArgs[0]) {
+	if len(evaluatedArgs) == 1 && isAbrupt(evaluatedArgs[0]) {
 		return evaluatedArgs[0]
 	}
 
-	switch function := evaluated.(type) {
-	case *object.Function:
-		{
-			argErr := validateFunctionArguments(function, evaluatedArgs)
-			if argErr != nil {
-				return argErr
-			}
-			return applyFunction(function, evaluatedArgs)
+	if errObj := validateCall(evaluated, evaluatedArgs); errObj != nil {
+		return errObj
+	}
+	result := callFunction(evaluated, evaluatedArgs, env.Runtime(), node.Span().Start)
+	if errObj, ok := result.(*object.Error); ok {
+		errObj.Stack = append(errObj.Stack, object.Frame{
+			Function: functionName(node, evaluated),
+			CallSite: node.Span().Start,
+		})
+	}
+	return result
+}
+
+// functionName returns the name a function is known by in stack traces
+func functionName(node *ast.CallExpression, function object.Object) string {
+	if fn, ok := function.(*object.Function); ok && fn.Name != "" {
+		return fn.Name
+	}
+	if identifier, ok := node.Function.(*ast.Identifier); ok {
+		return identifier.Value
+	}
+	return "<anonymous>"
+}
+
+// caller lets builtins call functions within the runtime of the program calling the builtin
+type caller struct {
+	runtime *object.Runtime
+	// Position of the call of the builtin, the functions it calls are reported as called from there
+	callSite token.Position
+}
+
+func (c *caller) Call(function object.Object, args ...object.Object) object.Object {
+	if errObj := validateCall(function, args); errObj != nil {
+		return errObj
+	}
+	result := callFunction(function, args, c.runtime, c.callSite)
+	if errObj, ok := result.(*object.Error); ok {
+		name := "<anonymous>"
+		if fn, ok := function.(*object.Function); ok && fn.Name != "" {
+			name = fn.Name
 		}
+		errObj.Stack = append(errObj.Stack, object.Frame{Function: name, CallSite: c.callSite})
+	}
+	return result
+}
+
+func validateCall(function object.Object, args []object.Object) *object.Error {
+	switch function := function.(type) {
+	case *object.Function:
+		return validateFunctionArguments(function, args)
 	case *object.BuiltIn:
-		{
-			return function.Fn(evaluatedArgs...)
+		return nil
+	default:
+		return object.NewError("not a function: %s", function.Type())
+	}
+}
+
+// callFunction calls a function or a builtin validated by validateCall
+func callFunction(function object.Object, args []object.Object, runtime *object.Runtime, callSite token.Position) object.Object {
+	switch function := function.(type) {
+	case *object.Function:
+		if errObj := runtime.EnterCall(); errObj != nil {
+			return errObj
 		}
+		result := applyFunction(function, args, runtime)
+		runtime.LeaveCall()
+		return result
 	default:
-		return object.NewError("not a function: %s", evaluated.Type())
+		result := function.(*object.BuiltIn).Call(&caller{runtime: runtime, callSite: callSite}, args...)
+		if errObj := runtime.Allocate(object.AllocationSize(result)); errObj != nil {
+			return errObj
+		}
+		return result
 	}
 }
 
@@ -366,8 +922,11 @@ func validateFunctionArguments(fn *object.Function, args []object.Object) *objec
 	return nil
 }
 
-func applyFunction(function *object.Function, args []object.Object) object.Object {
+// applyFunction runs the function within the runtime of the caller rather than
+// the one of the evaluation that defined it
+func applyFunction(function *object.Function, args []object.Object, runtime *object.Runtime) object.Object {
 	extendedEnv := extendEnv(function, args)
+	extendedEnv.SetRuntime(runtime)
 	evaluated := Eval(function.Body, extendedEnv)
 	return unwrappedReturnValue(evaluated)
 }
@@ -392,7 +951,7 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	var results []object.Object
 	for _, expression := range expressions {
 		evaluated := Eval(expression, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		results = append(results, evaluated)
@@ -400,11 +959,12 @@ func evalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 	return results
 }
 
+// isTruthy checks the value rather than the TRUE and FALSE singletons, comparisons may create new booleans
 func isTruthy(obj object.Object) bool {
-	switch obj {
-	case TRUE:
-		return true
-	case NULL, FALSE:
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
 		return false
 	default:
 		return true
@@ -415,3 +975,18 @@ func isError(obj object.Object) bool {
 	_, ok := obj.(*object.Error)
 	return ok
 }
+
+/*
+isAbrupt reports whether obj stops the evaluation of the enclosing expression:
+an error, or a break, continue or return coming out of an if expression used
+as a value, e.g. `let y = if (done) { break; } else { 5 }`. They propagate up
+to the loop or function they belong to, like in the vm.
+*/
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.Break, *object.Continue, *object.ReturnValue:
+		return true
+	default:
+		return false
+	}
+}
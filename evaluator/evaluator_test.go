@@ -1,8 +1,12 @@
 package evaluator
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
 	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
 	"github.com/zawlinnnaing/monkey-language-in-golang/object"
 	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
@@ -29,6 +33,19 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("Expected: %g, received %g", expected, result.Value)
+		return false
+	}
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 	if !ok {
@@ -77,6 +94,95 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{"3.5", 3.5},
+		{"-2.5", -2.5},
+		{"1e3", 1000.0},
+		{"1.5 + 1.5", 3.0},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"10 / 4", 2},
+		{"2 * 0.25 - 1", -0.5},
+		{"1 / 0.0 > 1000000", true},
+		{"1 == 1.0", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"2.5 < 3", true},
+		{"3 > 2.5", true},
+		{"!0.0", true},
+		{"!1.5", false},
+		{"let avg = fn(a, b) { (a + b) / 2.0 }; avg(1, 2)", 1.5},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestConversionBuiltInFunctions(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{`int(2.9)`, 2},
+		{`int(-2.9)`, -2},
+		{`int("42")`, 42},
+		{`int(7)`, 7},
+		{`int("4.2")`, `could not convert "4.2" to INTEGER`},
+		{`int(1e300)`, "could not convert 1e+300 to INTEGER"},
+		{`int([])`, "argument to `int` not supported, received ARRAY"},
+		{`float(2)`, 2.0},
+		{`float("1e-3")`, 0.001},
+		{`float(0.5)`, 0.5},
+		{`float("abc")`, `could not convert "abc" to FLOAT`},
+		{`float(true)`, "argument to `float` not supported, received BOOLEAN"},
+		{`float(1, 2)`, "wrong number of arguments: received 2, expected 1"},
+		{`str(1.5)`, "1.5"},
+		{`str(2.0)`, "2.0"},
+		{`str(10)`, "10"},
+		{`str("a")`, "a"},
+		{`str([1, true])`, "[1, true]"},
+		{`let a = [1]; a[0] = a; str(a)`, "[[...]]"},
+		{`let h = {}; h["k"] = h; str(h)`, "{k: {...}}"},
+		{`let a = [1]; let b = [a, a]; str(b)`, "[[1], [1]]"},
+		{`len(str(123))`, 3},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("Input %q: expected error %q, received %q", testCase.input, expected, result.Message)
+				}
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("Input %q: expected %q, received %q", testCase.input, expected, result.Value)
+				}
+			default:
+				t.Errorf("Input %q: expected String or Error, received %T (%+v)", testCase.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
 func TestEvalStringExpression(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -84,6 +190,9 @@ func TestEvalStringExpression(t *testing.T) {
 	}{
 		{`"Hello World!"`, "Hello World!"},
 		{`"hello" + " " + "world"`, "hello world"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{"`C:\\path\\n`", "C:\\path\\n"},
+		{`"\u{1F412}"`, "🐒"},
 	}
 	for _, testCase := range testCases {
 		evaluated := testEval(testCase.input)
@@ -128,6 +237,149 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestArithmeticAndComparisonOperators(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"7 % 3", "1"},
+		{"-7 % 3", "-1"},
+		{"7.5 % 2", "1.5"},
+		{"2 ** 10", "1024"},
+		{"2 ** 3 ** 2", "512"},
+		{"-2 ** 2", "-4"},
+		{"(-2) ** 3", "-8"},
+		{"2 ** 0", "1"},
+		{"2 ** -1", "0.5"},
+		{"2.0 ** 0.5 * 2.0 ** 0.5 > 1.99", "true"},
+		{"6 & 3", "2"},
+		{"6 | 3", "7"},
+		{"6 ^ 3", "5"},
+		{"~5", "-6"},
+		{"1 << 4", "16"},
+		{"-16 >> 2", "-4"},
+		{"1 << 2 + 1", "8"},
+		{"1 << 62", "4611686018427387904"},
+		{"-1 << 63", "-9223372036854775808"},
+		{"-1 >> 63", "-1"},
+		{"1 <= 1", "true"},
+		{"2 <= 1", "false"},
+		{"1 >= 2", "false"},
+		{"1.5 >= 1", "true"},
+		{`"a" == "a"`, "true"},
+		{`"a" != "a"`, "false"},
+		{`"abc" < "abd"`, "true"},
+		{`"b" > "abc"`, "true"},
+		{`"ab" <= "ab"`, "true"},
+		{`"" >= "a"`, "false"},
+		{`"é" > "z"`, "true"},
+		{"1 << -1", "negative shift count: -1"},
+		{"1 << 64", "shift count too large: 64"},
+		{"-1 >> 64", "shift count too large: 64"},
+		{"1 << 63", "integer overflow: 1 << 63"},
+		{"3 << 62", "integer overflow: 3 << 62"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		received := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			received = errObj.Message
+		}
+		if received != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, received)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"true && true", "true"},
+		{"true && false", "false"},
+		{"false || true", "true"},
+		{"false || false", "false"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"1 && 2", "2"},
+		{"0 && 2", "2"},
+		{`"" || "default"`, ""},
+		{"let x = if (false) { 1 }; x || 5", "5"},
+		{"1 == true || 7", "7"},
+		{"false && 1 + true", "false"},
+		{"true || 1 + true", "true"},
+		{"let n = 0; let inc = fn() { n += 1; true }; false && inc(); true || inc(); n", "0"},
+		{"true && 1 + true", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		received := evaluated.Inspect()
+		if errObj, ok := evaluated.(*object.Error); ok {
+			received = errObj.Message
+		}
+		if received != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, received)
+		}
+	}
+}
+
+func TestArithmeticErrors(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedMessage  string
+		expectedPosition string
+	}{
+		{"1 / 0", "division by zero", "1:3"},
+		{"let x = 0; 10 % x", "division by zero", "1:15"},
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1", "1:21"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2", "1:22"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2", "1:21"},
+		{"2 ** 63", "integer overflow: 2 ** 63", "1:3"},
+		{"(-9223372036854775807 - 1) / -1", "integer overflow: -9223372036854775808 / -1", "1:28"},
+		{"-(-9223372036854775807 - 1)", "integer overflow: -(-9223372036854775808)", "1:1"},
+	}
+	for _, testCase := range testCases {
+		errObj, ok := testEval(testCase.input).(*object.Error)
+		if !ok {
+			t.Errorf("Input %q: expected an error", testCase.input)
+			continue
+		}
+		if errObj.Message != testCase.expectedMessage {
+			t.Errorf("Input %q: expected %q, received %q", testCase.input, testCase.expectedMessage, errObj.Message)
+		}
+		if errObj.Pos.String() != testCase.expectedPosition {
+			t.Errorf("Input %q: expected position %s, received %s", testCase.input, testCase.expectedPosition, errObj.Pos)
+		}
+	}
+
+	for _, input := range []string{"-9223372036854775807 - 1", "3037000499 * 3037000499", "(-2) ** 63", "9223372036854775807 + -1"} {
+		if _, ok := testEval(input).(*object.Integer); !ok {
+			t.Errorf("Input %q: expected an integer, received %s", input, testEval(input).Inspect())
+		}
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	program := parser.New(lexer.New("let a = 1;\nlet b = a + 2;")).ParseProgram()
+	// An infix expression without right operand makes the evaluator panic
+	infix := program.Statements[1].(*ast.LetStatement).Value.(*ast.InfixExpression)
+	infix.Right = nil
+
+	errObj, ok := Eval(program, object.NewEnvironment()).(*object.Error)
+	if !ok {
+		t.Fatalf("Expected an error object")
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("Expected an internal error, received %q", errObj.Message)
+	}
+	if errObj.Pos.String() != "2:11" {
+		t.Errorf("Expected position 2:11, received %s", errObj.Pos)
+	}
+}
+
 func TestEvalBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -165,6 +417,10 @@ func TestEvalIfElseExpression(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (false) { 10 } else {}", nil},
+		{"fn() {}()", nil},
+		{"let nothing = fn() {}; if (nothing() == nothing()) { 10 }", 10},
 	}
 	for _, testCase := range testCases {
 		evaluated := testEval(testCase.input)
@@ -296,6 +552,155 @@ func TestLetStatement(t *testing.T) {
 	}
 }
 
+func TestAssignExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{"let a = 1; a = 2; a;", 2},
+		{"let a = 1; a = a + 1;", 2},
+		{"let a = 1; let b = 2; a = b = 3; a + b;", 6},
+		{"let a = 10; a += 5; a -= 3; a *= 2; a /= 4; a", 6},
+		{"let a = 1.5; a *= 2; a", 3.0},
+		{"let s = \"a\"; s += \"b\"; s", "ab"},
+		{
+			`let counter = fn() {
+			  let count = 0;
+			  fn() { count += 1 }
+			};
+			let next = counter();
+			next(); next();
+			next();`,
+			3,
+		},
+		{
+			`let total = 0;
+			let add = fn(x) { total = total + x };
+			add(2); add(3);
+			total;`,
+			5,
+		},
+		{"let a = 1; let f = fn() { let a = 2; a = 3; }; f(); a", 1},
+		{"x = 1", "cannot assign to undeclared identifier: x"},
+		{"len += 1", "cannot assign to undeclared identifier: len"},
+		{"let a = 1; a += true", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("Input %q: expected %q, received %q", testCase.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("Input %q: expected error %q, received %q", testCase.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("Input %q: expected String or Error, received %T (%+v)", testCase.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestIndexAssignment(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{"let a = [1, 2, 3]; a[0] = 10; a[0] + a[1];", 12},
+		{"let a = [1, 2, 3]; a[2] = 7;", 7},
+		{"let a = [1, 2, 3]; a[1] += 5; a[1];", 7},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 9; a[0];", 9},
+		{"let a = [[1], [2]]; a[1][0] = 5; a[1][0];", 5},
+		{"let a = [1]; let b = push(a, 2); b[0] = 5; a[0];", 1},
+		{`let h = {"a": 1}; h["a"] = 2; h["a"];`, 2},
+		{`let h = {}; h["new"] = 3; h["new"];`, 3},
+		{`let h = {"n": 1}; h["n"] *= 4; h["n"];`, 4},
+		{`let h = {}; let set = fn(k, v) { h[k] = v }; set(1, 2); h[1];`, 2},
+		{"let a = [1, 2, 3]; a[3] = 4;", "index out of range: 3 (length 3)"},
+		{"let a = [1, 2, 3]; a[-1] = 4;", "index out of range: -1 (length 3)"},
+		{`let a = [1]; a["x"] = 1;`, "index operator not supported: STRING"},
+		{`let h = {}; h[fn(x) { x }] = 1;`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x";`, "index assignment not supported: STRING"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("Input %q: object is not Error. got=%T (%+v)", testCase.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("Input %q: expected error %q, received %q", testCase.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let i = 0; while (i < 100000) { i += 1 }; i", 100000},
+		{"while (false) { 1 }", nil},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break; } }; i", 5},
+		{"let i = 0; let odd = 0; while (i < 10) { i += 1; if (i / 2 * 2 == i) { continue; } odd += 1; }; odd", 5},
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"for (x in [1, 2, 3]) { x }", nil},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } sum += x }; sum", 3},
+		{"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } sum += x }; sum", 8},
+		{"let n = 0; for (k in {1: 2, 3: 4}) { n += k }; n", 4},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{"let a = [1, 2]; for (x in a) { a = push(a, x) }; len(a)", 4},
+		{"for (x in [1, 2, 3]) { x }; x", 3},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()", 20},
+		{"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n += 1 } }; n", 2},
+		{"let n = 0; while (n < 3) { let f = fn() { n += 1 }; f() }; n", 3},
+		// break and continue in an if expression used as a value end the iteration
+		{"let x = 0; while (x < 3) { let y = if (x == 1) { break; } else { 5 }; x += 1 }; x", 1},
+		{"let n = 0; for (i in [1, 2, 3]) { n += if (i == 2) { continue; } else { i } }; n", 4},
+		{"let n = 0; while (true) { n += 1; 1 + if (true) { break; } }; n", 1},
+		{"let f = fn(x) { let y = if (x > 0) { return x * 2; } else { 0 }; y - 1 }; f(3)", 6},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"while (true) { 1 + true }", "type mismatch: INTEGER + BOOLEAN"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("Input %q: expected %q, received %q", testCase.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("Input %q: expected error %q, received %q", testCase.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("Input %q: expected String or Error, received %T (%+v)", testCase.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 	evaluated := testEval(input)
@@ -395,12 +800,27 @@ func TestBuiltInFunctions(t *testing.T) {
 		{`push(1, 1)`, "argument to `push` must be ARRAY, received INTEGER"},
 		{`push([1])`, "wrong number of arguments: received 1, expected 2"},
 		{`push([1], 2, 3)`, "wrong number of arguments: received 3, expected 2"},
+		{`push()`, "wrong number of arguments: received 0, expected 2"},
+		{`first()`, "wrong number of arguments: received 0, expected 1"},
 	}
 	for _, testCase := range testCases {
 		evaluated := testEval(testCase.input)
 		switch expected := testCase.expected.(type) {
 		case int:
 			testIntegerObject(t, evaluated, int64(expected))
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("Input %q: expected %d elements, received %d", testCase.input, len(expected), len(array.Elements))
+				continue
+			}
+			for i, element := range expected {
+				testIntegerObject(t, array.Elements[i], int64(element))
+			}
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
@@ -414,6 +834,46 @@ func TestBuiltInFunctions(t *testing.T) {
 	}
 }
 
+func TestStringCodePoints(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{`len("မြန်မာ")`, 6},
+		{`len("héllo")`, 5},
+		{`"héllo"[1]`, "é"},
+		{`"🐒!"[0]`, "🐒"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, nil},
+		{`let မြန်မာ = "ok"; မြန်မာ`, "ok"},
+		{`len(chars("မြန်မာ"))`, 6},
+		{`chars("aé")[1]`, "é"},
+		{`chars(1)`, "argument to `chars` must be STRING, received INTEGER"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("Input %q: expected %q, received %q", testCase.input, expected, result.Value)
+				}
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("Input %q: expected error %q, received %q", testCase.input, expected, result.Message)
+				}
+			default:
+				t.Errorf("Input %q: expected String or Error, received %T (%+v)", testCase.input, evaluated, evaluated)
+			}
+		}
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	testCases := []struct {
 		input    string
@@ -482,25 +942,48 @@ func TestHashLiteral(t *testing.T) {
 		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey]int64{
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := []struct {
+		key   object.Object
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
 	}
 
-	if len(result.Pairs) != len(expected) {
-		t.Fatalf("Hash has wrong number of pairs. got=%d", len(result.Pairs))
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong number of pairs. got=%d", result.Len())
 	}
 
-	for expectedKey, expectedValue := range expected {
-		pair, ok := result.Pairs[expectedKey]
+	for _, expectedPair := range expected {
+		value, ok := result.Get(expectedPair.key)
 		if !ok {
-			t.Errorf("no pair for given key in Pairs")
+			t.Errorf("no pair for key %s", expectedPair.key.Inspect())
+			continue
+		}
+		testIntegerObject(t, value, expectedPair.value)
+	}
+}
+
+func TestHashLiteralOrder(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, "{b: 1, a: 2, 3: 3, true: 4}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`keys({"z": 0, "y": 0, "x": 0})`, "[z, y, x]"},
+		// Keys and values are evaluated in source order
+		{`let log = []; let f = fn(x) { log = push(log, x); x }; {f("k1"): f(1), f("k2"): f(2)}; log`, "[k1, 1, k2, 2]"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		if evaluated.Inspect() != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, evaluated.Inspect())
 		}
-		testIntegerObject(t, pair.Value, expectedValue)
 	}
 }
 
@@ -516,6 +999,12 @@ func TestHashIndexExpression(t *testing.T) {
 		{`{5: 5}[5]`, 5},
 		{`{true: 5}[true]`, 5},
 		{`{false: 5}[false]`, 5},
+		{`{1.5: 5}[1.5]`, 5},
+		{`{1: 5}[1.0]`, 5},
+		{`{2.0: 5}[2]`, 5},
+		{`{1: 5, "1": 6}["1"]`, 6},
+		{`{1: 5}[true]`, nil},
+		{`{0.1 + 0.2: 5}[0.3]`, nil},
 	}
 	for _, testCase := range testCases {
 		evaluated := testEval(testCase.input)
@@ -527,3 +1016,325 @@ func TestHashIndexExpression(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+let compute = fn(x) {
+  add(x, true)
+};
+compute(1);`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Pos.String() != "2:5" {
+		t.Errorf("Expected error position 2:5, received %s", errObj.Pos)
+	}
+
+	expectedFrames := []struct {
+		function string
+		callSite string
+	}{
+		{"add", "5:3"},
+		{"compute", "7:1"},
+	}
+	if len(errObj.Stack) != len(expectedFrames) {
+		t.Fatalf("Expected %d frames, received %d: %+v", len(expectedFrames), len(errObj.Stack), errObj.Stack)
+	}
+	for i, expected := range expectedFrames {
+		frame := errObj.Stack[i]
+		if frame.Function != expected.function || frame.CallSite.String() != expected.callSite {
+			t.Errorf("Frame %d: expected %s at %s, received %s at %s", i, expected.function, expected.callSite, frame.Function, frame.CallSite)
+		}
+	}
+
+	expectedTrace := `ERROR: type mismatch: INTEGER + BOOLEAN
+  at 2:5
+  in add, called at 5:3
+  in compute, called at 7:1`
+	if errObj.StackTrace() != expectedTrace {
+		t.Errorf("Expected stack trace:\n%s\nreceived:\n%s", expectedTrace, errObj.StackTrace())
+	}
+}
+
+func TestErrorStackTraceFunctionNames(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedFunction string
+	}{
+		{"let f = fn() { 1 + true }; let g = f; g();", "f"},
+		{"let apply = fn(f) { f() }; apply(fn() { 1 + true });", "f"},
+		{"fn() { 1 + true }();", "<anonymous>"},
+		{`len(1)`, "len"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if len(errObj.Stack) == 0 {
+			t.Errorf("Input %q: expected stack frames, received none", testCase.input)
+			continue
+		}
+		if errObj.Stack[0].Function != testCase.expectedFunction {
+			t.Errorf("Input %q: expected innermost function %s, received %s", testCase.input, testCase.expectedFunction, errObj.Stack[0].Function)
+		}
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		input           string
+		ctx             context.Context
+		limits          object.Limits
+		expectedMessage string
+	}{
+		{"while (true) {}", context.Background(), object.Limits{MaxSteps: 1000}, "step limit exceeded (1000)"},
+		{"let f = fn() { f() }; f()", context.Background(), object.Limits{}, "maximum call depth exceeded (10000)"},
+		{"let f = fn(n) { if (n > 0) { f(n - 1) } }; f(100)", context.Background(), object.Limits{MaxCallDepth: 50}, "maximum call depth exceeded (50)"},
+		{"let a = []; while (true) { a = push(a, 1) }", context.Background(), object.Limits{MaxAllocations: 10000}, "allocation limit exceeded (10000)"},
+		{`let s = "x"; while (true) { s = s + s }`, context.Background(), object.Limits{MaxAllocations: 1 << 20}, "allocation limit exceeded (1048576)"},
+		{"let h = {}; let i = 0; while (i < 200000) { h[i] = i; i += 1 }; len(h)", context.Background(), object.Limits{MaxAllocations: 1000}, "allocation limit exceeded (1000)"},
+		{`while (true) { let s = "0123456789" }`, context.Background(), object.Limits{MaxAllocations: 1000}, "allocation limit exceeded (1000)"},
+		{`let s = "ab"; while (true) { s += s }`, context.Background(), object.Limits{MaxSteps: 1e6, MaxAllocations: 1e5}, "allocation limit exceeded (100000)"},
+		{`let a = ["ab"]; while (true) { a[0] += a[0] }`, context.Background(), object.Limits{MaxSteps: 1e6, MaxAllocations: 1e5}, "allocation limit exceeded (100000)"},
+		{"while (true) {}", cancelled, object.Limits{}, "evaluation cancelled: context canceled"},
+	}
+	for _, testCase := range testCases {
+		program := parser.New(lexer.New(testCase.input)).ParseProgram()
+		evaluated := EvalContext(testCase.ctx, program, object.NewEnvironment(), testCase.limits)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("Input %q: expected an error, received %s", testCase.input, evaluated.Inspect())
+			continue
+		}
+		if errObj.Message != testCase.expectedMessage {
+			t.Errorf("Input %q: expected %q, received %q", testCase.input, testCase.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestExecutionLimitsDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New("let i = 0; while (true) { i += 1 }")).ParseProgram()
+	evaluated := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "evaluation cancelled: context deadline exceeded" {
+		t.Errorf("Expected deadline error, received %s", evaluated.Inspect())
+	}
+}
+
+func TestExecutionLimitsApplyToEarlierFunctions(t *testing.T) {
+	env := object.NewEnvironment()
+	Eval(parser.New(lexer.New("let loop = fn() { while (true) {} };")).ParseProgram(), env)
+
+	program := parser.New(lexer.New("loop()")).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, env, object.Limits{MaxSteps: 500})
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "step limit exceeded (500)" {
+		t.Fatalf("Expected step limit error, received %s", evaluated.Inspect())
+	}
+
+	// The limits only apply to the call of EvalContext
+	evaluated = Eval(parser.New(lexer.New("let i = 0; while (i < 1000) { i += 1 }; i")).ParseProgram(), env)
+	testIntegerObject(t, evaluated, 1000)
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	registry := object.NewRegistry(CoreBuiltins())
+	registry.Remove("len")
+	registry.Register(object.BuiltinSpec{
+		Name:    "answer",
+		BuiltIn: &object.BuiltIn{Fn: func(args ...object.Object) object.Object { return &object.Integer{Value: 42} }},
+	})
+	env := object.NewEnvironment()
+	env.SetRegistry(registry)
+
+	testCases := []struct {
+		input    string
+		expected any
+	}{
+		{`answer()`, 42},
+		{`let f = fn() { answer() + 1 }; f()`, 43},
+		{`first([7, 8])`, 7},
+		{`len("four")`, "identifier not found: len"},
+		{`print(1)`, "identifier not found: print"},
+		{`let answer = fn() { 0 }; answer()`, 0},
+	}
+	for _, testCase := range testCases {
+		evaluated := Eval(parser.New(lexer.New(testCase.input)).ParseProgram(), env)
+		switch expected := testCase.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("Input %q: expected error %q, received %s", testCase.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+
+	// Environments without a registry see the default builtins
+	testIntegerObject(t, testEval(`len("four")`), 4)
+	if spec, ok := DefaultBuiltins().Spec("len"); !ok || spec.Signature() != "len(value: STRING|ARRAY|HASH)" {
+		t.Errorf("Expected the metadata of len, received %v", spec)
+	}
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"reduce([1, 2, 3], fn(acc, x) { acc * x })", "6"},
+		{`reduce(["a", "b"], fn(acc, x) { acc + x }, ">")`, ">ab"},
+		{"reduce([], fn(a, b) { a }, 0)", "0"},
+		{"let xs = []; each([1, 2], fn(x) { xs = push(xs, x) }); xs", "[1, 2]"},
+		{"find([1, 2, 3], fn(x) { x > 1 })", "2"},
+		{"any([], fn(x) { true })", "false"},
+		{"all([2, 4], fn(x) { x % 2 == 0 })", "true"},
+		{"zip([1, 2], [3, 4])", "[[1, 3], [2, 4]]"},
+		{"flat_map([[1], [2, 3]], fn(x) { x })", "[1, 2, 3]"},
+		{"sort_by([[2, 1], [1, 2], [2, 0]], fn(pair) { pair[0] })", "[[1, 2], [2, 1], [2, 0]]"},
+		{"group_by([1, 2, 3], fn(x) { x > 1 })[true]", "[2, 3]"},
+		{"let calls = 0; any([1, 2, 3], fn(x) { calls += 1; x == 2 }); calls", "2"},
+		{"reduce([], fn(a, b) { a })", "ERROR: `reduce` of an empty array without an initial value"},
+		{"reduce([1])", "ERROR: wrong number of arguments: received 1, expected 2 or 3"},
+		{"map([1, 2], fn(x) { x + true })", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"filter([1], fn() { true })", "ERROR: arguments mismatch. Defined 0, received: 1"},
+		{`group_by([1], fn(x) { [x] })`, "ERROR: unusable as hash key: ARRAY"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		if evaluated.Inspect() != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHigherOrderBuiltinsErrorStackTrace(t *testing.T) {
+	input := `let check = fn(x) {
+  x + true
+};
+let run = fn() { filter([1], check) };
+run();`
+
+	errObj, ok := testEval(input).(*object.Error)
+	if !ok {
+		t.Fatalf("Expected an error object")
+	}
+	expectedTrace := `ERROR: type mismatch: INTEGER + BOOLEAN
+  at 2:5
+  in check, called at 4:18
+  in filter, called at 4:18
+  in run, called at 5:1`
+	if errObj.StackTrace() != expectedTrace {
+		t.Errorf("Expected stack trace:\n%s\nreceived:\n%s", expectedTrace, errObj.StackTrace())
+	}
+
+	// Functions called by builtins count towards the limits of the evaluation
+	program := parser.New(lexer.New("map([1, 2], fn(x) { while (true) {} })")).ParseProgram()
+	evaluated := EvalContext(context.Background(), program, object.NewEnvironment(), object.Limits{MaxSteps: 100})
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "step limit exceeded (100)" {
+		t.Errorf("Expected step limit error, received %s", evaluated.Inspect())
+	}
+}
+
+func TestHashBuiltIns(t *testing.T) {
+	// Pairs are added one by one to check the insertion order
+	setup := `let h = {}; h["b"] = 1; h["a"] = 2; h[3] = true; `
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{setup + "keys(h)", "[b, a, 3]"},
+		{setup + "values(h)", "[1, 2, true]"},
+		{setup + "entries(h)", "[[b, 1], [a, 2], [3, true]]"},
+		{setup + `h["b"] = 5; keys(h)`, "[b, a, 3]"},
+		{setup + `[has(h, "a"), has(h, "c"), has(h, 3)]`, "[true, false, true]"},
+		{setup + `delete(h, "b")`, "{a: 2, 3: true}"},
+		{setup + `delete(h, "b"); len(h)`, "3"},
+		{setup + `delete(h, "missing")`, "{b: 1, a: 2, 3: true}"},
+		{setup + `merge(h, {"b": 0}, {"c": 4})`, "{b: 0, a: 2, 3: true, c: 4}"},
+		{setup + "len(h)", "3"},
+		{setup + "let s = []; for (k in h) { s = push(s, k) }; s", "[b, a, 3]"},
+		{setup + "h", "{b: 1, a: 2, 3: true}"},
+		{"keys({})", "[]"},
+		{"keys([1])", "ERROR: argument to `keys` must be HASH, received ARRAY"},
+		{"has({}, [1])", "ERROR: unusable as hash key: ARRAY"},
+		{"delete({}, fn() {})", "ERROR: unusable as hash key: FUNCTION"},
+		{"merge({}, 1)", "ERROR: argument to `merge` must be HASH, received INTEGER"},
+		{"merge()", "ERROR: wrong number of arguments: received 0, expected at least 1"},
+		{"values({}, 1)", "ERROR: wrong number of arguments: received 2, expected 1"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		if evaluated.Inspect() != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"[1, 2] == [1, 2]", "true"},
+		{"[1, 2] != [1, 2]", "false"},
+		{"[1, 2] == [2, 1]", "false"},
+		{"[1, [2, 3]] == [1, [2, 3.0]]", "true"},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, "true"},
+		{`{"a": 1} == {"a": 2}`, "false"},
+		{`{"a": 1} != {"a": 1, "b": 2}`, "true"},
+		{"[] == {}", "false"},
+		{"let f = fn() { 1 }; f == f", "true"},
+		{"fn() { 1 } == fn() { 1 }", "false"},
+		{"len == len", "true"},
+		{"let nothing = fn() {}; nothing() == nothing()", "true"},
+		{"let nothing = fn() {}; nothing() == false", "false"},
+		{"let a = [1]; let b = [1]; a[0] = a; b[0] = b; a == b", "true"},
+		{"true == true", "true"},
+		{"1 == true", "false"},
+		{`1 == "1"`, "ERROR: type mismatch: INTEGER == STRING"},
+		{`"1" != 1.0`, "ERROR: type mismatch: STRING != FLOAT"},
+		{`[1] == ["1"]`, "false"},
+		// Integers and floats are compared exactly, the same way by ==, structural equality and hash keys
+		{"9007199254740993 == 9007199254740992.0", "false"},
+		{"9007199254740993 != 9007199254740992.0", "true"},
+		{"9007199254740992 == 9007199254740992.0", "true"},
+		{"[9007199254740993] == [9007199254740992.0]", "false"},
+		{"[9007199254740992] == [9007199254740992.0]", "true"},
+		{"{9007199254740992.0: 1}[9007199254740993]", "null"},
+		{"{9007199254740992.0: 1}[9007199254740992]", "1"},
+		{"9007199254740993 > 9007199254740992.0", "true"},
+		{"9007199254740992.0 < 9007199254740993", "true"},
+		{"9007199254740993 <= 9007199254740992.0", "false"},
+		{"1 < 1.5", "true"},
+		{"-1 > -1.5", "true"},
+		{"2 >= 2.0", "true"},
+		{"9223372036854775807 < 9223372036854775807.0", "true"},
+		{"1 == 0.0 / 0.0", "false"},
+		{"1 != 0.0 / 0.0", "true"},
+		{"1 < 0.0 / 0.0 || 1 >= 0.0 / 0.0", "false"},
+	}
+	for _, testCase := range testCases {
+		evaluated := testEval(testCase.input)
+		if evaluated.Inspect() != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, evaluated.Inspect())
+		}
+	}
+}
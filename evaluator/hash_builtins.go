@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+)
+
+// Builtins of hashes, they list pairs in insertion order and never modify their arguments
+
+// HashBuiltins returns keys, values and the other builtins of hashes
+func HashBuiltins() *object.Registry {
+	registry := object.NewRegistry()
+	hash := object.Param{Name: "hash", Types: []object.ObjectType{object.HASH_OBJ}}
+	key := object.Param{Name: "key"}
+	registry.Register(object.BuiltinSpec{
+		Name:    "keys",
+		BuiltIn: &object.BuiltIn{Fn: keysBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{hash},
+		Doc:     "Returns the keys of a hash",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "values",
+		BuiltIn: &object.BuiltIn{Fn: valuesBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{hash},
+		Doc:     "Returns the values of a hash",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "entries",
+		BuiltIn: &object.BuiltIn{Fn: entriesBuiltIn},
+		Arity:   1,
+		Params:  []object.Param{hash},
+		Doc:     "Returns the [key, value] pairs of a hash",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "has",
+		BuiltIn: &object.BuiltIn{Fn: hasBuiltIn},
+		Arity:   2,
+		Params:  []object.Param{hash, key},
+		Doc:     "Reports whether a hash has a key",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "delete",
+		BuiltIn: &object.BuiltIn{Fn: deleteBuiltIn},
+		Arity:   2,
+		Params:  []object.Param{hash, key},
+		Doc:     "Returns a new hash without key",
+	})
+	registry.Register(object.BuiltinSpec{
+		Name:    "merge",
+		BuiltIn: &object.BuiltIn{Fn: mergeBuiltIn},
+		Arity:   object.VARIADIC,
+		Params:  []object.Param{hash},
+		Doc:     "Returns a new hash with the pairs of all hashes, later hashes override earlier ones",
+	})
+	return registry
+}
+
+var keysBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	hash, errObj := validateHashArgs("keys", 1, args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Key)
+	}
+	return &object.Array{Elements: elements}
+}
+
+var valuesBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	hash, errObj := validateHashArgs("values", 1, args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, pair.Value)
+	}
+	return &object.Array{Elements: elements}
+}
+
+var entriesBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	hash, errObj := validateHashArgs("entries", 1, args...)
+	if errObj != nil {
+		return errObj
+	}
+	elements := make([]object.Object, 0, hash.Len())
+	for _, pair := range hash.Pairs() {
+		elements = append(elements, &object.Array{Elements: []object.Object{pair.Key, pair.Value}})
+	}
+	return &object.Array{Elements: elements}
+}
+
+var hasBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	hash, errObj := validateHashArgs("has", 2, args...)
+	if errObj != nil {
+		return errObj
+	}
+	if _, ok := args[1].(object.Hashable); !ok {
+		return object.NewError("unusable as hash key: %s", args[1].Type())
+	}
+	_, ok := hash.Get(args[1])
+	return nativeBoolToBooleanObject(ok)
+}
+
+var deleteBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	hash, errObj := validateHashArgs("delete", 2, args...)
+	if errObj != nil {
+		return errObj
+	}
+	if _, ok := args[1].(object.Hashable); !ok {
+		return object.NewError("unusable as hash key: %s", args[1].Type())
+	}
+	result := hash.Copy()
+	result.Delete(args[1])
+	return result
+}
+
+var mergeBuiltIn object.BuiltInFunction = func(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return object.NewError("wrong number of arguments: received 0, expected at least 1")
+	}
+	result := object.NewHash()
+	for _, arg := range args {
+		hash, ok := arg.(*object.Hash)
+		if !ok {
+			return object.NewError("argument to `merge` must be HASH, received %s", arg.Type())
+		}
+		for _, pair := range hash.Pairs() {
+			result.Set(pair.Key, pair.Value)
+		}
+	}
+	return result
+}
+
+func validateHashArgs(fnName string, expectedLen int, args ...object.Object) (*object.Hash, object.Object) {
+	if err := validateArgsLen(expectedLen, args...); err != nil {
+		return nil, err
+	}
+	hash, ok := args[0].(*object.Hash)
+	if !ok {
+		return nil, object.NewError("argument to `%s` must be HASH, received %s", fnName, args[0].Type())
+	}
+	return hash, nil
+}
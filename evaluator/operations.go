@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+// Operations on evaluated values, shared with the bytecode vm so that both
+// engines have the same semantics.
+
+func InfixOperation(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+func IndexOperation(left, index object.Object) object.Object {
+	return evalIndexOperation(left, index)
+}
+
+func IndexAssignOperation(container, index, value object.Object) object.Object {
+	return evalIndexAssignment(container, index, value)
+}
+
+// Iterate returns the values a for loop goes over
+func Iterate(iterable object.Object) ([]object.Object, *object.Error) {
+	return iterate(iterable)
+}
+
+/*
+CallFunction calls a function or a builtin from Go, e.g. a Monkey callback
+of an embedding program. The call runs within runtime, without limits other
+than the default call depth when it is nil.
+*/
+func CallFunction(function object.Object, args []object.Object, runtime *object.Runtime) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = object.NewError("internal error: %v", r)
+		}
+	}()
+	if runtime == nil {
+		runtime = object.NewRuntime(context.Background(), object.Limits{})
+	}
+	if errObj := validateCall(function, args); errObj != nil {
+		return errObj
+	}
+	return callFunction(function, args, runtime, token.Position{})
+}
+
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// BuiltinNames returns the names of the default builtins in a stable order
+func BuiltinNames() []string {
+	return defaultBuiltins.Names()
+}
+
+func LookupBuiltin(name string) (*object.BuiltIn, bool) {
+	return defaultBuiltins.Lookup(name)
+}
@@ -1,43 +1,188 @@
 package lexer
 
 import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
 	"github.com/zawlinnnaing/monkey-language-in-golang/token"
 )
 
+/*
+Lexer walks the input code point by code point. Positions are byte offsets
+into the input, columns count code points.
+*/
 type Lexer struct {
-	input        string
+	filename string
+	input    string
+	// Byte offsets of the current char and of the next one
 	position     int
 	readPosition int
-	ch           byte
+	ch           rune
+	// Line and column of the current char
+	line   int
+	column int
+	// Malformed tokens, the lexer still returns a best effort token for them
+	errors []diagnostic.Diagnostic
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.column += 1
+	size := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition]
+		// Invalid UTF-8 decodes to utf8.RuneError and ends up as an ILLEGAL token
+		l.ch, size = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += size
+}
+
+// Errors returns the diagnostics of malformed tokens
+func (l *Lexer) Errors() []diagnostic.Diagnostic {
+	return l.errors
 }
 
+func (l *Lexer) addError(code diagnostic.Code, span token.Span, format string, a ...interface{}) {
+	l.errors = append(l.errors, diagnostic.New(code, span, format, a...))
+}
+
+// nextPosition returns the source position right after the current char
+func (l *Lexer) nextPosition() token.Position {
+	position := l.currentPosition()
+	position.Offset = l.readPosition
+	position.Column += 1
+	return position
+}
+
+/*
+readString reads a double quoted string and decodes its escape sequences:
+\n, \t, \r, \\, \" and \u{...} with 1 to 6 hex digits. The current char is
+left on the closing quote.
+*/
 func (l *Lexer) readString() string {
-	// Skipping opening double quote
-	startStringPosition := l.position + 1
+	start := l.currentPosition()
+	var out strings.Builder
+	for {
+		// Skipping opening double quote
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String()
+		case 0:
+			l.addError(diagnostic.UNTERMINATED_STR, token.Span{Start: start, End: l.currentPosition()}, "unterminated string literal")
+			return out.String()
+		case '\\':
+			l.readEscape(&out)
+			if l.ch == 0 {
+				l.addError(diagnostic.UNTERMINATED_STR, token.Span{Start: start, End: l.currentPosition()}, "unterminated string literal")
+				return out.String()
+			}
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// readEscape decodes the escape sequence starting at the current backslash,
+// the current char is left on its last char
+func (l *Lexer) readEscape(out *strings.Builder) {
+	start := l.currentPosition()
+	l.readChar()
+	switch l.ch {
+	case 'n':
+		out.WriteByte('\n')
+	case 't':
+		out.WriteByte('\t')
+	case 'r':
+		out.WriteByte('\r')
+	case '\\':
+		out.WriteByte('\\')
+	case '"':
+		out.WriteByte('"')
+	case 'u':
+		l.readUnicodeEscape(out, start)
+	case 0:
+		// Reported as an unterminated string
+	default:
+		l.addError(diagnostic.INVALID_ESCAPE, token.Span{Start: start, End: l.nextPosition()}, "unknown escape sequence \\%c", l.ch)
+		out.WriteRune(l.ch)
+	}
+}
+
+// readUnicodeEscape reads the `{...}` part of a \u{...} escape
+func (l *Lexer) readUnicodeEscape(out *strings.Builder, start token.Position) {
+	if l.peekChar() != '{' {
+		l.addError(diagnostic.INVALID_ESCAPE, token.Span{Start: start, End: l.nextPosition()}, "expected `{` after \\u")
+		return
+	}
+	l.readChar()
+	digitsStart := l.readPosition
+	for isHexDigit(l.peekChar()) {
+		l.readChar()
+	}
+	digits := l.input[digitsStart:l.readPosition]
+	if l.peekChar() != '}' || len(digits) == 0 || len(digits) > 6 {
+		l.addError(diagnostic.INVALID_ESCAPE, token.Span{Start: start, End: l.nextPosition()}, "invalid unicode escape, expected \\u{...} with 1 to 6 hex digits")
+		return
+	}
+	l.readChar()
+
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(value)) {
+		l.addError(diagnostic.INVALID_ESCAPE, token.Span{Start: start, End: l.nextPosition()}, "invalid unicode code point U+%s", strings.ToUpper(digits))
+		return
+	}
+	out.WriteRune(rune(value))
+}
+
+// readRawString reads a backtick string, which can span lines and has no escape sequences
+func (l *Lexer) readRawString() string {
+	start := l.currentPosition()
+	contentStart := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		if l.ch == '`' {
+			return l.input[contentStart:l.position]
+		}
+		if l.ch == 0 {
+			l.addError(diagnostic.UNTERMINATED_STR, token.Span{Start: start, End: l.currentPosition()}, "unterminated raw string literal")
+			return l.input[contentStart:l.position]
 		}
 	}
-	// Doesn't include end double quote
-	return l.input[startStringPosition:l.position]
+}
+
+// currentPosition returns the source position of the current char
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	comments := l.skipTrivia()
+
+	start := l.currentPosition()
+	tok := l.readToken()
+	tok.Pos = start
+	tok.End = l.currentPosition()
+	tok.Comments = comments
+
+	return tok
+}
 
-	l.skipsWhitespace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -51,8 +196,11 @@ func (l *Lexer) NextToken() token.Token {
 	case '"':
 		tok.Type = token.STRING
 		tok.Literal = l.readString()
+	case '`':
+		tok.Type = token.STRING
+		tok.Literal = l.readRawString()
 	case '+':
-		tok = *token.New(token.PLUS, string(l.ch))
+		tok = l.readOperator(token.PLUS, token.PLUS_ASSIGN)
 	case ',':
 		tok = *token.New(token.COMMA, string(l.ch))
 	case ';':
@@ -68,15 +216,35 @@ func (l *Lexer) NextToken() token.Token {
 	case 0:
 		tok = *token.New(token.EOF, "")
 	case '<':
-		tok = *token.New(token.LT, "<")
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharOperator(token.LT_EQ)
+		case '<':
+			tok = l.readTwoCharOperator(token.SHIFT_LEFT)
+		default:
+			tok = *token.New(token.LT, "<")
+		}
 	case '>':
-		tok = *token.New(token.GT, ">")
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharOperator(token.GT_EQ)
+		case '>':
+			tok = l.readTwoCharOperator(token.SHIFT_RIGHT)
+		default:
+			tok = *token.New(token.GT, ">")
+		}
 	case '/':
-		tok = *token.New(token.SLASH, "/")
+		tok = l.readOperator(token.SLASH, token.SLASH_ASSIGN)
 	case '*':
-		tok = *token.New(token.ASTERISK, "*")
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharOperator(token.POWER)
+		} else {
+			tok = l.readOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
+		}
+	case '%':
+		tok = *token.New(token.PERCENT, "%")
 	case '-':
-		tok = *token.New(token.MINUS, "-")
+		tok = l.readOperator(token.MINUS, token.MINUS_ASSIGN)
 	case '!':
 		nextChar := l.peekChar()
 		if nextChar == '=' {
@@ -85,6 +253,22 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = *token.New(token.BANG, "!")
 		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharOperator(token.AND)
+		} else {
+			tok = *token.New(token.AMPERSAND, "&")
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharOperator(token.OR)
+		} else {
+			tok = *token.New(token.PIPE, "|")
+		}
+	case '^':
+		tok = *token.New(token.CARET, "^")
+	case '~':
+		tok = *token.New(token.TILDE, "~")
 	case ':':
 		tok = *token.New(token.COLON, ":")
 	case '[':
@@ -98,8 +282,7 @@ func (l *Lexer) NextToken() token.Token {
 			return tok
 		}
 		if isDigit(l.ch) {
-			tok.Literal = l.readDigit()
-			tok.Type = token.INT
+			tok.Literal, tok.Type = l.readDigit()
 			return tok
 		}
 		tok = *token.New(token.ILLEGAL, string(l.ch))
@@ -111,20 +294,68 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// readOperator reads an operator that has a compound assignment form, e.g. `+` and `+=`
+func (l *Lexer) readOperator(operator, assignOperator token.TokenType) token.Token {
+	if l.peekChar() == '=' {
+		l.readChar()
+		return *token.New(assignOperator, string(assignOperator))
+	}
+	return *token.New(operator, string(operator))
+}
+
+// readTwoCharOperator consumes the second char of an operator such as `<=`
+func (l *Lexer) readTwoCharOperator(operator token.TokenType) token.Token {
+	l.readChar()
+	return *token.New(operator, string(operator))
+}
+
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isIdentifierPart(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readDigit() string {
+/*
+readDigit reads an integer or a float literal. Floats have a fraction
+(`3.14`), an exponent (`1e-9`) or both, a dot must be followed by a digit so
+`1.` stays an integer.
+*/
+func (l *Lexer) readDigit() (string, token.TokenType) {
 	position := l.position
+	tokenType := token.TokenType(token.INT)
+	l.readDigits()
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
+		l.readChar()
+		l.readDigits()
+	}
+	if (l.ch == 'e' || l.ch == 'E') && l.exponentFollows() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+	return l.input[position:l.position], tokenType
+}
+
+func (l *Lexer) readDigits() {
 	for isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+}
+
+// exponentFollows reports whether the current 'e' starts an exponent, e.g. `e9` or `e-9`
+func (l *Lexer) exponentFollows() bool {
+	next := l.peekChar()
+	if next == '+' || next == '-' {
+		return l.readPosition+1 < len(l.input) && isDigit(rune(l.input[l.readPosition+1]))
+	}
+	return isDigit(next)
 }
 
 func (l *Lexer) skipsWhitespace() {
@@ -133,25 +364,117 @@ func (l *Lexer) skipsWhitespace() {
 	}
 }
 
-func (l *Lexer) peekChar() byte {
+// skipTrivia skips whitespace and comments, the comments are returned to be
+// attached to the next token
+func (l *Lexer) skipTrivia() []token.Comment {
+	var comments []token.Comment
+	for {
+		l.skipsWhitespace()
+		if l.ch != '/' || (l.peekChar() != '/' && l.peekChar() != '*') {
+			return comments
+		}
+		start := l.currentPosition()
+		if l.peekChar() == '/' {
+			l.skipLineComment()
+		} else {
+			l.skipBlockComment()
+		}
+		comments = append(comments, token.Comment{
+			Text: l.input[start.Offset:l.position],
+			Pos:  start,
+			End:  l.currentPosition(),
+		})
+	}
+}
+
+// skipLineComment leaves the current char on the newline ending the comment
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a block comment. Block comments nest, so code that
+// contains comments can be commented out: `/* a /* b */ c */` is one comment.
+func (l *Lexer) skipBlockComment() {
+	start := l.currentPosition()
+	depth := 0
+	for {
+		switch {
+		case l.ch == 0:
+			l.addError(diagnostic.UNTERMINATED_CMT, token.Span{Start: start, End: l.currentPosition()}, "unterminated block comment")
+			return
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+			if depth == 0 {
+				l.readChar()
+				return
+			}
+		}
+		l.readChar()
+	}
+}
+
+// skipShebang skips a leading "#!" line, so scripts can be made executable
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isLetter(ch byte) bool {
-	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_'
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
+// isLetter reports whether ch can start an identifier
+func isLetter(ch rune) bool {
+	return ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ch == '_' ||
+		(ch >= utf8.RuneSelf && unicode.IsLetter(ch))
+}
+
+// isIdentifierPart reports whether ch can continue an identifier besides
+// letters: digits, and combining marks used by scripts like Burmese
+func isIdentifierPart(ch rune) bool {
+	return isDigit(ch) || (ch >= utf8.RuneSelf && (unicode.IsDigit(ch) || unicode.In(ch, unicode.Mn, unicode.Mc)))
 }
 
 func New(input string) *Lexer {
+	return NewWithFilename("", input)
+}
+
+// NewWithFilename creates a lexer whose token positions refer to the given file name.
+func NewWithFilename(filename, input string) *Lexer {
 	l := &Lexer{
-		input: input,
+		filename: filename,
+		input:    input,
+		line:     1,
 	}
 	l.readChar()
 	return l
 }
+
+// NewScript creates a lexer for a script file, a leading "#!" line is skipped
+func NewScript(filename, input string) *Lexer {
+	l := NewWithFilename(filename, input)
+	l.skipShebang()
+	return l
+}
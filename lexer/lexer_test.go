@@ -13,7 +13,7 @@ let add = fn(x, y) {
 
 x + y; };
 
-let result = add(five, ten); !-/*5; 5 < 10 > 5;
+let result = add(five, ten); !-/ *5; 5 < 10 > 5;
 
 if (5 < 10) { return true; } else {
 
@@ -134,3 +134,337 @@ return false; }
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  "foo" == x;`
+	expected := []struct {
+		expectedTokenType token.TokenType
+		expectedLine      int
+		expectedColumn    int
+		expectedOffset    int
+		expectedEndColumn int
+	}{
+		{token.LET, 1, 1, 0, 4},
+		{token.IDENT, 1, 5, 4, 6},
+		{token.ASSIGN, 1, 7, 6, 8},
+		{token.INT, 1, 9, 8, 10},
+		{token.SEMICOLON, 1, 10, 9, 11},
+		{token.STRING, 2, 3, 13, 8},
+		{token.EQ, 2, 9, 19, 11},
+		{token.IDENT, 2, 12, 22, 13},
+		{token.SEMICOLON, 2, 13, 23, 14},
+		{token.EOF, 2, 14, 24, 15},
+	}
+
+	lexer := NewWithFilename("test.mk", input)
+
+	for i, expectedToken := range expected {
+		actualToken := lexer.NextToken()
+		if actualToken.Type != expectedToken.expectedTokenType {
+			t.Fatalf("Test[%d]: Expected token type: %s, received: %s", i, expectedToken.expectedTokenType, actualToken.Type)
+		}
+		pos := actualToken.Pos
+		if pos.Filename != "test.mk" {
+			t.Errorf("Test[%d]: Expected filename: test.mk, received: %s", i, pos.Filename)
+		}
+		if pos.Line != expectedToken.expectedLine || pos.Column != expectedToken.expectedColumn {
+			t.Errorf("Test[%d]: Expected position: %d:%d, received: %d:%d", i, expectedToken.expectedLine, expectedToken.expectedColumn, pos.Line, pos.Column)
+		}
+		if pos.Offset != expectedToken.expectedOffset {
+			t.Errorf("Test[%d]: Expected offset: %d, received: %d", i, expectedToken.expectedOffset, pos.Offset)
+		}
+		if actualToken.End.Column != expectedToken.expectedEndColumn {
+			t.Errorf("Test[%d]: Expected end column: %d, received: %d", i, expectedToken.expectedEndColumn, actualToken.End.Column)
+		}
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	input := "#!/usr/bin/env monkey\nlet x = 1;"
+	lexer := NewScript("script.mk", input)
+
+	tok := lexer.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("Expected token type: %s, received: %s", token.LET, tok.Type)
+	}
+	if tok.Pos.Line != 2 || tok.Pos.Column != 1 {
+		t.Errorf("Expected position 2:1, received: %s", tok.Pos)
+	}
+
+	// Only scripts skip it, other input keeps the line
+	for _, lexer := range []*Lexer{New(input), NewWithFilename("script.mk", input)} {
+		tok := lexer.NextToken()
+		if tok.Type != token.ILLEGAL || tok.Literal != "#" {
+			t.Errorf("Expected ILLEGAL #, received %s %q", tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	input := `3.14 1e-9 2E+3 6.02e23 10 1.foo 3e x`
+	expected := []struct {
+		expectedTokenType token.TokenType
+		expectedLiteral   string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "6.02e23"},
+		{token.INT, "10"},
+		{token.INT, "1"},
+		{token.ILLEGAL, "."},
+		{token.IDENT, "foo"},
+		{token.INT, "3"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+	for i, expectedToken := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != expectedToken.expectedTokenType {
+			t.Fatalf("tests[%d] - Expected token type: %s, received: %s", i, expectedToken.expectedTokenType, tok.Type)
+		}
+		if tok.Literal != expectedToken.expectedLiteral {
+			t.Fatalf("tests[%d] - Expected literal: %s, received: %s", i, expectedToken.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	testCases := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"plain"`, "plain"},
+		{`"say \"hi\"\n"`, "say \"hi\"\n"},
+		{`"a\tb\\c\r"`, "a\tb\\c\r"},
+		{`"\u{48}\u{e9}\u{1F412}"`, "Hé🐒"},
+		{"`raw \\n \"quoted\"\nline`", "raw \\n \"quoted\"\nline"},
+	}
+	for _, testCase := range testCases {
+		lexer := New(testCase.input)
+		tok := lexer.NextToken()
+		if tok.Type != token.STRING {
+			t.Fatalf("Input %q: expected token type: %s, received: %s", testCase.input, token.STRING, tok.Type)
+		}
+		if tok.Literal != testCase.expectedLiteral {
+			t.Errorf("Input %q: expected literal: %q, received: %q", testCase.input, testCase.expectedLiteral, tok.Literal)
+		}
+		if len(lexer.Errors()) != 0 {
+			t.Errorf("Input %q: expected no errors, received: %v", testCase.input, lexer.Errors())
+		}
+		if next := lexer.NextToken(); next.Type != token.EOF {
+			t.Errorf("Input %q: expected EOF after the string, received: %s", testCase.input, next.Type)
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	testCases := []struct {
+		input           string
+		expectedMessage string
+		expectedSpan    string
+	}{
+		{`"abc`, "unterminated string literal", "1:1-1:5"},
+		{`"abc\`, "unterminated string literal", "1:1-1:6"},
+		{"`abc", "unterminated raw string literal", "1:1-1:5"},
+		{`"a\qb"`, `unknown escape sequence \q`, "1:3-1:5"},
+		{`"\u41"`, "expected `{` after \\u", "1:2-1:4"},
+		{`"\u{}"`, `invalid unicode escape, expected \u{...} with 1 to 6 hex digits`, "1:2-1:5"},
+		{`"\u{D800}"`, "invalid unicode code point U+D800", "1:2-1:10"},
+	}
+	for _, testCase := range testCases {
+		lexer := New(testCase.input)
+		tok := lexer.NextToken()
+		if tok.Type != token.STRING {
+			t.Errorf("Input %q: expected token type: %s, received: %s", testCase.input, token.STRING, tok.Type)
+		}
+		errors := lexer.Errors()
+		if len(errors) != 1 {
+			t.Errorf("Input %q: expected 1 error, received: %v", testCase.input, errors)
+			continue
+		}
+		if errors[0].Message != testCase.expectedMessage {
+			t.Errorf("Input %q: expected message: %q, received: %q", testCase.input, testCase.expectedMessage, errors[0].Message)
+		}
+		if errors[0].Span.String() != testCase.expectedSpan {
+			t.Errorf("Input %q: expected span: %s, received: %s", testCase.input, testCase.expectedSpan, errors[0].Span)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let မြန်မာ = "နေကောင်းလား"; let café2 = 1; x1 + π; ¿`
+	expected := []struct {
+		expectedTokenType token.TokenType
+		expectedLiteral   string
+		expectedPosition  string
+	}{
+		{token.LET, "let", "1:1"},
+		{token.IDENT, "မြန်မာ", "1:5"},
+		{token.ASSIGN, "=", "1:12"},
+		{token.STRING, "နေကောင်းလား", "1:14"},
+		{token.SEMICOLON, ";", "1:27"},
+		{token.LET, "let", "1:29"},
+		{token.IDENT, "café2", "1:33"},
+		{token.ASSIGN, "=", "1:39"},
+		{token.INT, "1", "1:41"},
+		{token.SEMICOLON, ";", "1:42"},
+		{token.IDENT, "x1", "1:44"},
+		{token.PLUS, "+", "1:47"},
+		{token.IDENT, "π", "1:49"},
+		{token.SEMICOLON, ";", "1:50"},
+		{token.ILLEGAL, "¿", "1:52"},
+		{token.EOF, "", "1:53"},
+	}
+
+	lexer := New(input)
+	for i, expectedToken := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != expectedToken.expectedTokenType {
+			t.Fatalf("tests[%d] - Expected token type: %s, received: %s", i, expectedToken.expectedTokenType, tok.Type)
+		}
+		if tok.Literal != expectedToken.expectedLiteral {
+			t.Fatalf("tests[%d] - Expected literal: %s, received: %s", i, expectedToken.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.String() != expectedToken.expectedPosition {
+			t.Errorf("tests[%d] - Expected position: %s, received: %s", i, expectedToken.expectedPosition, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 1; // trailing
+/* block /* nested */ still comment */ x / 2
+/* at the end */`
+	expected := []struct {
+		expectedTokenType token.TokenType
+		expectedComments  []string
+	}{
+		{token.LET, []string{"// header"}},
+		{token.IDENT, nil},
+		{token.ASSIGN, nil},
+		{token.INT, nil},
+		{token.SEMICOLON, nil},
+		{token.IDENT, []string{"// trailing", "/* block /* nested */ still comment */"}},
+		{token.SLASH, nil},
+		{token.INT, nil},
+		{token.EOF, []string{"/* at the end */"}},
+	}
+
+	lexer := New(input)
+	for i, expectedToken := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != expectedToken.expectedTokenType {
+			t.Fatalf("tests[%d] - Expected token type: %s, received: %s", i, expectedToken.expectedTokenType, tok.Type)
+		}
+		if len(tok.Comments) != len(expectedToken.expectedComments) {
+			t.Fatalf("tests[%d] - Expected %d comments, received: %v", i, len(expectedToken.expectedComments), tok.Comments)
+		}
+		for j, comment := range tok.Comments {
+			if comment.Text != expectedToken.expectedComments[j] {
+				t.Errorf("tests[%d] - Expected comment: %q, received: %q", i, expectedToken.expectedComments[j], comment.Text)
+			}
+		}
+	}
+	if len(lexer.Errors()) != 0 {
+		t.Errorf("Expected no errors, received: %v", lexer.Errors())
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	lexer := New("x /* a\nb */ y")
+	lexer.NextToken()
+	tok := lexer.NextToken()
+	if len(tok.Comments) != 1 {
+		t.Fatalf("Expected 1 comment, received: %v", tok.Comments)
+	}
+	if span := tok.Comments[0].Span().String(); span != "1:3-2:5" {
+		t.Errorf("Expected comment span 1:3-2:5, received: %s", span)
+	}
+	if tok.Pos.String() != "2:6" {
+		t.Errorf("Expected position 2:6, received: %s", tok.Pos)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	lexer := New("x /* a /* b */")
+	lexer.NextToken()
+	if tok := lexer.NextToken(); tok.Type != token.EOF {
+		t.Errorf("Expected token type: %s, received: %s", token.EOF, tok.Type)
+	}
+	errors := lexer.Errors()
+	if len(errors) != 1 || errors[0].Message != "unterminated block comment" || errors[0].Span.Start.String() != "1:3" {
+		t.Errorf("Expected an unterminated block comment error at 1:3, received: %v", errors)
+	}
+}
+
+func TestAssignmentOperators(t *testing.T) {
+	input := `x = 1; x += 2; x -= 3; x *= 4; x /= 5; x == 6`
+	expected := []token.TokenType{
+		token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.PLUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.MINUS_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.ASTERISK_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH_ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.EQ, token.INT, token.EOF,
+	}
+
+	lexer := New(input)
+	for i, expectedType := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - Expected token type: %s, received: %s", i, expectedType, tok.Type)
+		}
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	input := `a && b || !c & d | e`
+	expected := []struct {
+		expectedTokenType token.TokenType
+		expectedLiteral   string
+	}{
+		{token.IDENT, "a"},
+		{token.AND, "&&"},
+		{token.IDENT, "b"},
+		{token.OR, "||"},
+		{token.BANG, "!"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "d"},
+		{token.PIPE, "|"},
+		{token.IDENT, "e"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+	for i, testCase := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != testCase.expectedTokenType || tok.Literal != testCase.expectedLiteral {
+			t.Fatalf("tests[%d] - Expected %s %q, received %s %q", i, testCase.expectedTokenType, testCase.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestArithmeticAndComparisonOperators(t *testing.T) {
+	input := `a <= b >= c % d ** e *= f << g >> h ^ ~i < j > k`
+	expected := []token.TokenType{
+		token.IDENT, token.LT_EQ, token.IDENT, token.GT_EQ, token.IDENT, token.PERCENT,
+		token.IDENT, token.POWER, token.IDENT, token.ASTERISK_ASSIGN, token.IDENT,
+		token.SHIFT_LEFT, token.IDENT, token.SHIFT_RIGHT, token.IDENT, token.CARET,
+		token.TILDE, token.IDENT, token.LT, token.IDENT, token.GT, token.IDENT, token.EOF,
+	}
+
+	lexer := New(input)
+	for i, expectedType := range expected {
+		tok := lexer.NextToken()
+		if tok.Type != expectedType {
+			t.Fatalf("tests[%d] - Expected token type: %s, received: %s", i, expectedType, tok.Type)
+		}
+	}
+}
@@ -1,19 +1,11 @@
 package main
 
 import (
-	"fmt"
 	"os"
-	"os/user"
 
-	"github.com/zawlinnnaing/monkey-language-in-golang/repl"
+	"github.com/zawlinnnaing/monkey-language-in-golang/cli"
 )
 
 func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Hello, %v. Welcome to the monkey programming language! \n", user.Username)
-	fmt.Println("Type a command")
-	repl.Start(os.Stdin, os.Stdout)
+	os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
 }
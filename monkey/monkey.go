@@ -0,0 +1,225 @@
+/*
+Package monkey embeds the Monkey interpreter in Go programs.
+
+	interpreter := monkey.New(monkey.WithStdout(&out))
+	interpreter.Register("now", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: time.Now().Unix()}
+	})
+	if _, err := interpreter.Eval(ctx, "let add = fn(a, b) { a + b };"); err != nil {
+		return err
+	}
+	result, err := interpreter.Call("add", 1, 2)
+
+Programs are run by the tree-walking evaluator. Each Interpreter has its own
+globals, builtins and output, so any number of them can be used side by side.
+The builtins are held in an object.Registry, see WithBuiltins to restrict them.
+*/
+package monkey
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
+	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
+)
+
+// Interpreter keeps the globals of the programs it evaluates. It can be used
+// from several goroutines, evaluations and calls are run one at a time.
+type Interpreter struct {
+	mu       sync.Mutex
+	env      *object.Environment
+	builtins *object.Registry
+	limits   object.Limits
+
+	stdout   io.Writer
+	stdin    io.Reader
+	filename string
+}
+
+type Option func(*Interpreter)
+
+// WithStdout sets where `print` writes, os.Stdout by default
+func WithStdout(w io.Writer) Option {
+	return func(i *Interpreter) { i.stdout = w }
+}
+
+// WithStdin sets where `input` reads from, os.Stdin by default
+func WithStdin(r io.Reader) Option {
+	return func(i *Interpreter) { i.stdin = r }
+}
+
+/*
+WithBuiltins replaces the default builtins by a copy of builtins, e.g.
+evaluator.CoreBuiltins() for programs that must not do any io.
+*/
+func WithBuiltins(builtins *object.Registry) Option {
+	return func(i *Interpreter) { i.builtins = object.NewRegistry(builtins) }
+}
+
+// WithLimits bounds the resources of each call to Eval and Call
+func WithLimits(limits object.Limits) Option {
+	return func(i *Interpreter) { i.limits = limits }
+}
+
+// WithFilename sets the file name positions in errors refer to
+func WithFilename(filename string) Option {
+	return func(i *Interpreter) { i.filename = filename }
+}
+
+func New(options ...Option) *Interpreter {
+	i := &Interpreter{
+		env:    object.NewEnvironment(),
+		stdout: os.Stdout,
+		stdin:  os.Stdin,
+	}
+	for _, option := range options {
+		option(i)
+	}
+	if i.builtins == nil {
+		i.builtins = object.NewRegistry(evaluator.CoreBuiltins(), evaluator.IOBuiltins(i.stdout, i.stdin))
+	}
+	i.env.SetRegistry(i.builtins)
+	return i
+}
+
+// SyntaxError is returned by Eval when the source can't be parsed
+type SyntaxError struct {
+	Source      string
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (e *SyntaxError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		messages[i] = d.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+/*
+Eval runs src and returns the value of its last statement. Bindings made by
+src are kept for later calls. Parser errors are returned as *SyntaxError and
+runtime errors as *object.Error.
+*/
+func (i *Interpreter) Eval(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.NewWithFilename(i.filename, src))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, &SyntaxError{Source: src, Diagnostics: p.Errors()}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return result(evaluator.EvalContext(ctx, program, i.env, i.limits))
+}
+
+// Call calls the function bound to fnName, Go arguments are converted with object.FromGo
+func (i *Interpreter) Call(fnName string, args ...any) (object.Object, error) {
+	return i.CallContext(context.Background(), fnName, args...)
+}
+
+func (i *Interpreter) CallContext(ctx context.Context, fnName string, args ...any) (object.Object, error) {
+	arguments := make([]object.Object, len(args))
+	for index, arg := range args {
+		argument, err := object.FromGo(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", index+1, err)
+		}
+		arguments[index] = argument
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	function, ok := i.env.Get(fnName)
+	if !ok {
+		builtIn, isBuiltIn := i.builtins.Lookup(fnName)
+		if !isBuiltIn {
+			return nil, fmt.Errorf("identifier not found: %s", fnName)
+		}
+		function = builtIn
+	}
+	return result(evaluator.CallFunction(function, arguments, object.NewRuntime(ctx, i.limits)))
+}
+
+// Register makes fn callable from Monkey as name, globals of the same name take precedence
+func (i *Interpreter) Register(name string, fn object.BuiltInFunction) {
+	i.RegisterBuiltin(object.BuiltinSpec{
+		Name:    name,
+		BuiltIn: &object.BuiltIn{Fn: fn},
+		Arity:   object.VARIADIC,
+	})
+}
+
+// RegisterFunc makes any Go func callable from Monkey as name, see object.WrapFunc
+func (i *Interpreter) RegisterFunc(name string, fn any) error {
+	builtIn, err := object.WrapFunc(fn)
+	if err != nil {
+		return err
+	}
+	arity := object.VARIADIC
+	if fnType := reflect.TypeOf(fn); !fnType.IsVariadic() {
+		arity = fnType.NumIn()
+	}
+	i.RegisterBuiltin(object.BuiltinSpec{Name: name, BuiltIn: builtIn, Arity: arity})
+	return nil
+}
+
+// RegisterBuiltin adds a builtin with its metadata
+func (i *Interpreter) RegisterBuiltin(spec object.BuiltinSpec) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.builtins.Register(spec)
+}
+
+// Unregister removes builtins, e.g. the default `input` of a program without stdin
+func (i *Interpreter) Unregister(names ...string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.builtins.Remove(names...)
+}
+
+// Builtin returns the metadata of a builtin
+func (i *Interpreter) Builtin(name string) (object.BuiltinSpec, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.builtins.Spec(name)
+}
+
+// Set binds a global to a value converted with object.FromGo, replacing any previous binding of name
+func (i *Interpreter) Set(name string, value any) error {
+	obj, err := object.FromGo(value)
+	if err != nil {
+		return err
+	}
+	i.setObject(name, obj)
+	return nil
+}
+
+func (i *Interpreter) setObject(name string, obj object.Object) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.env.Set(name, obj)
+}
+
+// Get returns the value of a global
+func (i *Interpreter) Get(name string) (object.Object, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.env.Get(name)
+}
+
+func result(obj object.Object) (object.Object, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		return nil, errObj
+	}
+	return obj, nil
+}
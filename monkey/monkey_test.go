@@ -0,0 +1,251 @@
+package monkey
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
+	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+)
+
+func testEval(t *testing.T, interpreter *Interpreter, src string) object.Object {
+	result, err := interpreter.Eval(context.Background(), src)
+	if err != nil {
+		t.Fatalf("Input %q: unexpected error: %s", src, err)
+	}
+	return result
+}
+
+func TestEvalKeepsGlobals(t *testing.T) {
+	interpreter := New()
+	testEval(t, interpreter, "let a = 5; let double = fn(x) { x * 2 };")
+	result := testEval(t, interpreter, "double(a) + 1")
+	if result.Inspect() != "11" {
+		t.Errorf("Expected 11, received %s", result.Inspect())
+	}
+}
+
+func TestEmptyBlocksAreNull(t *testing.T) {
+	interpreter := New()
+	for _, src := range []string{"if (true) {}", "if (false) {}", "if (false) { 1 } else {}", "fn() {}()", "let f = fn(x) {}; f(1)"} {
+		result := testEval(t, interpreter, src)
+		if result != object.NULL {
+			t.Errorf("Input %q: expected null, received %v", src, result)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	interpreter := New()
+	testEval(t, interpreter, "let add = fn(a, b) { a + b };")
+
+	result, err := interpreter.Call("add", &object.Integer{Value: 1}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if result.Inspect() != "3" {
+		t.Errorf("Expected 3, received %s", result.Inspect())
+	}
+
+	result, err = interpreter.Call("len", &object.String{Value: "four"})
+	if err != nil || result.Inspect() != "4" {
+		t.Errorf("Expected 4, received %v (%v)", result, err)
+	}
+
+	testCases := []struct {
+		fnName          string
+		args            []any
+		expectedMessage string
+	}{
+		{"missing", nil, "identifier not found: missing"},
+		{"add", []any{1}, "arguments mismatch. Defined 2, received: 1"},
+		{"add", []any{1, true}, "type mismatch: INTEGER + BOOLEAN"},
+		{"add", []any{1, make(chan int)}, "argument 2: cannot convert chan int to a Monkey value"},
+	}
+	for _, testCase := range testCases {
+		_, err := interpreter.Call(testCase.fnName, testCase.args...)
+		if err == nil || err.Error() != testCase.expectedMessage {
+			t.Errorf("Call %s: expected error %q, received %v", testCase.fnName, testCase.expectedMessage, err)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	interpreter := New()
+	calls := 0
+	interpreter.Register("greet", func(args ...object.Object) object.Object {
+		calls++
+		return &object.String{Value: "hello " + args[0].Inspect()}
+	})
+	result := testEval(t, interpreter, `greet("monkey")`)
+	if result.Inspect() != "hello monkey" || calls != 1 {
+		t.Errorf("Expected greet to be called once, received %s after %d calls", result.Inspect(), calls)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	interpreter := New()
+	err := interpreter.RegisterFunc("repeat", func(s string, n int) (string, error) {
+		if n < 0 {
+			return "", errors.New("negative count")
+		}
+		return strings.Repeat(s, n), nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	result := testEval(t, interpreter, `repeat("ab", 3)`)
+	if result.Inspect() != "ababab" {
+		t.Errorf("Expected ababab, received %s", result.Inspect())
+	}
+	if _, err := interpreter.Eval(context.Background(), `repeat("ab", -1)`); err == nil || err.Error() != "negative count" {
+		t.Errorf("Expected negative count error, received %v", err)
+	}
+	if err := interpreter.RegisterFunc("invalid", 5); err == nil {
+		t.Errorf("Expected an error when registering a non func")
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	sandboxed := New(WithBuiltins(evaluator.CoreBuiltins()))
+	if _, err := sandboxed.Eval(context.Background(), `print("hi")`); err == nil || err.Error() != "identifier not found: print" {
+		t.Errorf("Expected print not to be found, received %v", err)
+	}
+	result := testEval(t, sandboxed, `len("four")`)
+	if result.Inspect() != "4" {
+		t.Errorf("Expected 4, received %s", result.Inspect())
+	}
+
+	interpreter := New()
+	interpreter.Unregister("input")
+	if _, err := interpreter.Eval(context.Background(), `input()`); err == nil || err.Error() != "identifier not found: input" {
+		t.Errorf("Expected input not to be found, received %v", err)
+	}
+	if _, ok := New().Builtin("input"); !ok {
+		t.Errorf("Expected other interpreters to keep input")
+	}
+
+	if err := interpreter.RegisterFunc("add", func(a, b int) int { return a + b }); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	spec, ok := interpreter.Builtin("add")
+	if !ok || spec.Arity != 2 {
+		t.Errorf("Expected add to take 2 arguments, received %v", spec)
+	}
+	if result, err := interpreter.Call("add", 1, 2); err != nil || result.Inspect() != "3" {
+		t.Errorf("Expected 3, received %v (%v)", result, err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	interpreter := New()
+	interpreter.Set("limit", &object.Integer{Value: 3})
+	interpreter.Set("config", map[string]any{"factor": 2.5, "names": []string{"a", "b"}})
+	testEval(t, interpreter, `let total = limit * 2; let scaled = limit * config["factor"];`)
+
+	total, ok := interpreter.Get("total")
+	if !ok || total.Inspect() != "6" {
+		t.Errorf("Expected total to be 6, received %v", total)
+	}
+	scaled, _ := interpreter.Get("scaled")
+	if scaled.Inspect() != "7.5" {
+		t.Errorf("Expected scaled to be 7.5, received %s", scaled.Inspect())
+	}
+	if err := interpreter.Set("invalid", func() {}); err != nil {
+		t.Errorf("Expected funcs to be wrapped, received %s", err)
+	}
+	if err := interpreter.Set("invalid", make(chan int)); err == nil {
+		t.Errorf("Expected an error for channels")
+	}
+	type node struct{ Next *node }
+	cyclic := &node{}
+	cyclic.Next = cyclic
+	if err := interpreter.Set("invalid", cyclic); err == nil {
+		t.Errorf("Expected an error for values referring to themselves")
+	}
+	if _, ok := interpreter.Get("missing"); ok {
+		t.Errorf("Expected missing not to be defined")
+	}
+}
+
+func TestStdoutAndStdin(t *testing.T) {
+	var out bytes.Buffer
+	interpreter := New(WithStdout(&out), WithStdin(strings.NewReader("Ada\nLovelace")))
+	testEval(t, interpreter, `print("first: " + input()); print("last: " + input()); print(input())`)
+
+	expected := "first: Ada\nlast: Lovelace\nnull\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, received %q", expected, out.String())
+	}
+}
+
+func TestInstancesAreIsolated(t *testing.T) {
+	var firstOut, secondOut bytes.Buffer
+	first := New(WithStdout(&firstOut))
+	second := New(WithStdout(&secondOut))
+
+	testEval(t, first, `let name = "first"; print(name);`)
+	testEval(t, second, `let name = "second"; print(name);`)
+	if firstOut.String() != "first\n" || secondOut.String() != "second\n" {
+		t.Errorf("Expected separate outputs, received %q and %q", firstOut.String(), secondOut.String())
+	}
+	if _, err := second.Eval(context.Background(), "let x = name; x"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	result, _ := first.Get("name")
+	if result.Inspect() != "first" {
+		t.Errorf("Expected first name to be unchanged, received %s", result.Inspect())
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	interpreter := New(WithFilename("script.mk"))
+
+	_, err := interpreter.Eval(context.Background(), "let x = ;")
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected *SyntaxError, received %T (%v)", err, err)
+	}
+	if len(syntaxErr.Diagnostics) != 1 || syntaxErr.Diagnostics[0].Code != diagnostic.EXPECTED_EXPR {
+		t.Errorf("Expected an expected expression diagnostic, received %v", syntaxErr.Diagnostics)
+	}
+
+	// Only script files skip a "#!" line
+	_, err = interpreter.Eval(context.Background(), "#!/usr/bin/env monkey\n1")
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("Expected *SyntaxError for a #! line, received %T (%v)", err, err)
+	}
+
+	_, err = interpreter.Eval(context.Background(), "1 + true")
+	var runtimeErr *object.Error
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("Expected *object.Error, received %T (%v)", err, err)
+	}
+	if runtimeErr.Message != "type mismatch: INTEGER + BOOLEAN" || runtimeErr.Pos.String() != "script.mk:1:3" {
+		t.Errorf("Expected type mismatch at script.mk:1:3, received %s", runtimeErr.StackTrace())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	interpreter := New(WithLimits(object.Limits{MaxSteps: 1000}))
+	testEval(t, interpreter, "let spin = fn() { while (true) {} };")
+
+	if _, err := interpreter.Eval(context.Background(), "spin()"); err == nil || err.Error() != "step limit exceeded (1000)" {
+		t.Errorf("Expected step limit error from Eval, received %v", err)
+	}
+	if _, err := interpreter.Call("spin"); err == nil || err.Error() != "step limit exceeded (1000)" {
+		t.Errorf("Expected step limit error from Call, received %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	unlimited := New()
+	testEval(t, unlimited, "let spin = fn() { while (true) {} };")
+	if _, err := unlimited.CallContext(ctx, "spin"); err == nil || err.Error() != "evaluation cancelled: context canceled" {
+		t.Errorf("Expected cancellation error, received %v", err)
+	}
+}
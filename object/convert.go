@@ -0,0 +1,585 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// Struct fields are converted to hash keys named after their `monkey` tag, or
+// after the field name without tag. Fields tagged `monkey:"-"` are skipped.
+const STRUCT_TAG = "monkey"
+
+var (
+	objectType = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+/*
+FromGo converts a Go value to a Monkey value: integers, floats, strings, bools,
+slices and arrays, maps, structs, pointers to them and funcs, which are
+wrapped with WrapFunc. nil converts to null and objects are kept as they are.
+Values referring to themselves, e.g. through a pointer, are an error.
+*/
+func FromGo(value any) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+	return fromValue(reflect.ValueOf(value), references{})
+}
+
+// references holds the pointers, slices and maps being converted, values referring to themselves can't be converted
+type references map[reference]bool
+
+type reference struct {
+	typ     reflect.Type
+	pointer uintptr
+	length  int
+}
+
+func referenceOf(value reflect.Value) reference {
+	ref := reference{typ: value.Type(), pointer: value.Pointer()}
+	if value.Kind() == reflect.Slice {
+		ref.length = value.Len()
+	}
+	return ref
+}
+
+func (r references) enter(value reflect.Value) error {
+	ref := referenceOf(value)
+	if r[ref] {
+		return fmt.Errorf("cannot convert %s referring to itself", value.Type())
+	}
+	r[ref] = true
+	return nil
+}
+
+func (r references) leave(value reflect.Value) {
+	delete(r, referenceOf(value))
+}
+
+func fromValue(value reflect.Value, converting references) (Object, error) {
+	if value.Type().Implements(objectType) {
+		if (value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface) && value.IsNil() {
+			return NULL, nil
+		}
+		return value.Interface().(Object), nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		if value.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Integer{Value: value.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d overflows INTEGER", value.Uint())
+		}
+		return &Integer{Value: int64(value.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Float{Value: value.Float()}, nil
+	case reflect.String:
+		return &String{Value: value.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice {
+			if value.IsNil() {
+				return NULL, nil
+			}
+			if err := converting.enter(value); err != nil {
+				return nil, err
+			}
+			defer converting.leave(value)
+		}
+		elements := make([]Object, value.Len())
+		for i := range elements {
+			element, err := fromValue(value.Index(i), converting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		if err := converting.enter(value); err != nil {
+			return nil, err
+		}
+		defer converting.leave(value)
+		hash := NewHash()
+		for _, key := range sortedMapKeys(value) {
+			if err := setHashPair(hash, key, value.MapIndex(key), converting); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := NewHash()
+		for _, field := range structFields(value.Type()) {
+			fieldValue, err := value.FieldByIndexErr(field.index)
+			if err != nil {
+				// Promoted through a nil embedded pointer
+				continue
+			}
+			key := reflect.ValueOf(field.name)
+			if err := setHashPair(hash, key, fieldValue, converting); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		if value.Kind() == reflect.Pointer {
+			if err := converting.enter(value); err != nil {
+				return nil, err
+			}
+			defer converting.leave(value)
+		}
+		return fromValue(value.Elem(), converting)
+	case reflect.Func:
+		if value.IsNil() {
+			return NULL, nil
+		}
+		return WrapFunc(value.Interface())
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Monkey value", value.Type())
+	}
+}
+
+func setHashPair(hash *Hash, key, value reflect.Value, converting references) error {
+	keyObj, err := fromValue(key, converting)
+	if err != nil {
+		return err
+	}
+	valueObj, err := fromValue(value, converting)
+	if err != nil {
+		return err
+	}
+	if errObj := hash.Set(keyObj, valueObj); errObj != nil {
+		return errObj
+	}
+	return nil
+}
+
+// sortedMapKeys orders the keys of maps with basic key types, Go maps have no order of their own
+func sortedMapKeys(value reflect.Value) []reflect.Value {
+	keys := value.MapKeys()
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		default:
+			return false
+		}
+	})
+	return keys
+}
+
+type structField struct {
+	name  string
+	index []int
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup(STRUCT_TAG); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fields = append(fields, structField{name: name, index: field.Index})
+	}
+	return fields
+}
+
+/*
+ToGo converts a Monkey value to a Go value: int64, float64, string, bool,
+[]any and nil for null. Hashes with string keys only convert to
+map[string]any, other hashes to map[any]any. Objects without a Go
+equivalent, e.g. functions, are returned as they are.
+*/
+func ToGo(obj Object) (any, error) {
+	return toGo(obj, containers{})
+}
+
+func toGo(obj Object, converting containers) (any, error) {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Integer:
+		return obj.Value, nil
+	case *Float:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Array:
+		if err := converting.enter(obj); err != nil {
+			return nil, err
+		}
+		defer converting.leave(obj)
+		elements := make([]any, len(obj.Elements))
+		for i, element := range obj.Elements {
+			value, err := toGo(element, converting)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	case *Hash:
+		if err := converting.enter(obj); err != nil {
+			return nil, err
+		}
+		defer converting.leave(obj)
+		return hashToGo(obj, converting)
+	default:
+		return obj, nil
+	}
+}
+
+func hashToGo(hash *Hash, converting containers) (any, error) {
+	stringKeys := make(map[string]any, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, ok := pair.Key.(*String)
+		if !ok {
+			stringKeys = nil
+			break
+		}
+		value, err := toGo(pair.Value, converting)
+		if err != nil {
+			return nil, err
+		}
+		stringKeys[key.Value] = value
+	}
+	if stringKeys != nil {
+		return stringKeys, nil
+	}
+
+	anyKeys := make(map[any]any, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, err := toGo(pair.Key, converting)
+		if err != nil {
+			return nil, err
+		}
+		value, err := toGo(pair.Value, converting)
+		if err != nil {
+			return nil, err
+		}
+		anyKeys[key] = value
+	}
+	return anyKeys, nil
+}
+
+// toType converts obj to a Go value of type t, e.g. an argument of a wrapped func
+func toType(obj Object, t reflect.Type) (reflect.Value, error) {
+	return convertTo(obj, t, containers{})
+}
+
+func convertTo(obj Object, t reflect.Type, converting containers) (reflect.Value, error) {
+	// Parameters such as Object or *Integer take the object itself
+	if t.Implements(objectType) && reflect.TypeOf(obj).AssignableTo(t) {
+		return reflect.ValueOf(obj), nil
+	}
+
+	value := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		goValue, err := toGo(obj, converting)
+		if err != nil {
+			return value, err
+		}
+		if goValue == nil {
+			return value, nil
+		}
+		if !reflect.TypeOf(goValue).AssignableTo(t) {
+			return value, conversionError(obj, t)
+		}
+		value.Set(reflect.ValueOf(goValue))
+		return value, nil
+	case reflect.Bool:
+		boolean, ok := obj.(*Boolean)
+		if !ok {
+			return value, conversionError(obj, t)
+		}
+		value.SetBool(boolean.Value)
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return value, conversionError(obj, t)
+		}
+		if value.OverflowInt(integer.Value) {
+			return value, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		value.SetInt(integer.Value)
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		integer, ok := obj.(*Integer)
+		if !ok {
+			return value, conversionError(obj, t)
+		}
+		if integer.Value < 0 || value.OverflowUint(uint64(integer.Value)) {
+			return value, fmt.Errorf("%d overflows %s", integer.Value, t)
+		}
+		value.SetUint(uint64(integer.Value))
+		return value, nil
+	case reflect.Float32, reflect.Float64:
+		switch number := obj.(type) {
+		case *Integer:
+			value.SetFloat(float64(number.Value))
+		case *Float:
+			value.SetFloat(number.Value)
+		default:
+			return value, conversionError(obj, t)
+		}
+		return value, nil
+	case reflect.String:
+		str, ok := obj.(*String)
+		if !ok {
+			return value, conversionError(obj, t)
+		}
+		value.SetString(str.Value)
+		return value, nil
+	case reflect.Slice, reflect.Array:
+		return arrayToType(obj, t, converting)
+	case reflect.Map:
+		return hashToMap(obj, t, converting)
+	case reflect.Struct:
+		return hashToStruct(obj, t, converting)
+	case reflect.Pointer:
+		if obj == NULL {
+			return value, nil
+		}
+		elem, err := convertTo(obj, t.Elem(), converting)
+		if err != nil {
+			return value, err
+		}
+		pointer := reflect.New(t.Elem())
+		pointer.Elem().Set(elem)
+		return pointer, nil
+	default:
+		return value, conversionError(obj, t)
+	}
+}
+
+func arrayToType(obj Object, t reflect.Type, converting containers) (reflect.Value, error) {
+	array, ok := obj.(*Array)
+	if !ok {
+		return reflect.Value{}, conversionError(obj, t)
+	}
+	if err := converting.enter(array); err != nil {
+		return reflect.Value{}, err
+	}
+	defer converting.leave(array)
+	var value reflect.Value
+	if t.Kind() == reflect.Array {
+		if t.Len() != len(array.Elements) {
+			return value, fmt.Errorf("cannot convert ARRAY of length %d to %s", len(array.Elements), t)
+		}
+		value = reflect.New(t).Elem()
+	} else {
+		value = reflect.MakeSlice(t, len(array.Elements), len(array.Elements))
+	}
+	for i, element := range array.Elements {
+		elementValue, err := convertTo(element, t.Elem(), converting)
+		if err != nil {
+			return value, err
+		}
+		value.Index(i).Set(elementValue)
+	}
+	return value, nil
+}
+
+func hashToMap(obj Object, t reflect.Type, converting containers) (reflect.Value, error) {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return reflect.Value{}, conversionError(obj, t)
+	}
+	if err := converting.enter(hash); err != nil {
+		return reflect.Value{}, err
+	}
+	defer converting.leave(hash)
+	value := reflect.MakeMapWithSize(t, hash.Len())
+	for _, pair := range hash.Pairs() {
+		key, err := convertTo(pair.Key, t.Key(), converting)
+		if err != nil {
+			return value, err
+		}
+		elem, err := convertTo(pair.Value, t.Elem(), converting)
+		if err != nil {
+			return value, err
+		}
+		value.SetMapIndex(key, elem)
+	}
+	return value, nil
+}
+
+// hashToStruct sets the fields named by string keys, missing keys leave the zero value
+func hashToStruct(obj Object, t reflect.Type, converting containers) (reflect.Value, error) {
+	hash, ok := obj.(*Hash)
+	if !ok {
+		return reflect.Value{}, conversionError(obj, t)
+	}
+	if err := converting.enter(hash); err != nil {
+		return reflect.Value{}, err
+	}
+	defer converting.leave(hash)
+	value := reflect.New(t).Elem()
+	for _, field := range structFields(t) {
+		fieldObj, ok := hash.Get(&String{Value: field.name})
+		if !ok {
+			continue
+		}
+		fieldValue, err := convertTo(fieldObj, t.FieldByIndex(field.index).Type, converting)
+		if err != nil {
+			return value, fmt.Errorf("field %s: %w", field.name, err)
+		}
+		target, err := allocatedField(value, field.index)
+		if err != nil {
+			return value, fmt.Errorf("field %s: %w", field.name, err)
+		}
+		target.Set(fieldValue)
+	}
+	return value, nil
+}
+
+// allocatedField is FieldByIndex allocating the nil embedded pointers promoted fields are reached through
+func allocatedField(value reflect.Value, index []int) (reflect.Value, error) {
+	for i, fieldIndex := range index {
+		if i > 0 && value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				if !value.CanSet() {
+					return reflect.Value{}, fmt.Errorf("cannot allocate unexported embedded %s", value.Type())
+				}
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		value = value.Field(fieldIndex)
+	}
+	return value, nil
+}
+
+// containers holds the arrays and hashes being converted, values containing themselves can't be converted
+type containers map[Object]bool
+
+func (c containers) enter(obj Object) error {
+	if c[obj] {
+		return fmt.Errorf("cannot convert %s containing itself", obj.Type())
+	}
+	c[obj] = true
+	return nil
+}
+
+func (c containers) leave(obj Object) {
+	delete(c, obj)
+}
+
+func conversionError(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to %s", obj.Type(), t)
+}
+
+/*
+WrapFunc makes a builtin of a Go func. Arguments are converted to the types of
+the parameters, a mismatch is reported as a Monkey error. The func can return
+nothing, a value, an error or a value and an error; a non-nil error becomes a
+Monkey error.
+*/
+func WrapFunc(fn any) (*BuiltIn, error) {
+	fnValue := reflect.ValueOf(fn)
+	if !fnValue.IsValid() {
+		return nil, fmt.Errorf("cannot wrap nil, expected a func")
+	}
+	fnType := fnValue.Type()
+	if fnType.Kind() != reflect.Func {
+		return nil, fmt.Errorf("cannot wrap %s, expected a func", fnType)
+	}
+	numOut := fnType.NumOut()
+	if numOut > 2 || (numOut == 2 && fnType.Out(1) != errorType) {
+		return nil, fmt.Errorf("cannot wrap %s, expected results (), (T), (error) or (T, error)", fnType)
+	}
+
+	return &BuiltIn{Fn: func(args ...Object) Object {
+		in, errObj := funcArguments(fnType, args)
+		if errObj != nil {
+			return errObj
+		}
+		return funcResult(fnValue.Call(in))
+	}}, nil
+}
+
+func funcArguments(fnType reflect.Type, args []Object) ([]reflect.Value, *Error) {
+	numIn := fnType.NumIn()
+	if fnType.IsVariadic() {
+		if len(args) < numIn-1 {
+			return nil, NewError("wrong number of arguments: received %d, expected at least %d", len(args), numIn-1)
+		}
+	} else if len(args) != numIn {
+		return nil, NewError("wrong number of arguments: received %d, expected %d", len(args), numIn)
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var paramType reflect.Type
+		if fnType.IsVariadic() && i >= numIn-1 {
+			paramType = fnType.In(numIn - 1).Elem()
+		} else {
+			paramType = fnType.In(i)
+		}
+		value, err := toType(arg, paramType)
+		if err != nil {
+			return nil, NewError("argument %d: %s", i+1, err)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
+
+func funcResult(out []reflect.Value) Object {
+	if len(out) == 0 {
+		return NULL
+	}
+	last := out[len(out)-1]
+	if last.Type() == errorType {
+		if !last.IsNil() {
+			return NewError("%s", last.Interface().(error))
+		}
+		if len(out) == 1 {
+			return NULL
+		}
+	}
+	result, err := fromValue(out[0], references{})
+	if err != nil {
+		return NewError("%s", err)
+	}
+	return result
+}
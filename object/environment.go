@@ -1,8 +1,14 @@
 package object
 
+import "context"
+
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	// Enclosed environments share the runtime of their outer environment
+	runtime *Runtime
+	// Builtins visible from the environment, nil for the defaults of the evaluator
+	registry *Registry
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -18,12 +24,54 @@ func (e *Environment) Set(name string, val Object) Object {
 	return val
 }
 
+// Assign updates the nearest existing binding of name, it reports false when
+// there is none
+func (e *Environment) Assign(name string, val Object) bool {
+	if _, ok := e.store[name]; ok {
+		e.store[name] = val
+		return true
+	}
+	if e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return false
+}
+
+func (e *Environment) Runtime() *Runtime {
+	if e == nil {
+		return nil
+	}
+	return e.runtime
+}
+
+func (e *Environment) SetRuntime(runtime *Runtime) {
+	e.runtime = runtime
+}
+
+func (e *Environment) Registry() *Registry {
+	if e == nil {
+		return nil
+	}
+	return e.registry
+}
+
+func (e *Environment) SetRegistry(registry *Registry) {
+	e.registry = registry
+}
+
 func NewEnvironment() *Environment {
-	return &Environment{store: make(map[string]Object), outer: nil}
+	return &Environment{
+		store:   make(map[string]Object),
+		outer:   nil,
+		runtime: NewRuntime(context.Background(), Limits{}),
+	}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{
+		store:    make(map[string]Object),
+		outer:    outer,
+		runtime:  outer.Runtime(),
+		registry: outer.Registry(),
+	}
 }
@@ -0,0 +1,67 @@
+package object
+
+/*
+Equal reports whether two values are the same, as `==` does. Numbers are
+compared by value so that 1 equals 1.0, an integer only equals a float of
+exactly its value, not one it rounds to. Arrays and hashes are compared element
+by element regardless of the order of the pairs, and functions and other
+objects are only equal to themselves.
+*/
+func Equal(left, right Object) bool {
+	return equal(left, right, map[[2]Object]bool{})
+}
+
+// comparing holds the pairs of arrays and hashes being compared, so values containing themselves terminate
+func equal(left, right Object, comparing map[[2]Object]bool) bool {
+	switch left := left.(type) {
+	case *Integer, *Float, *String, *Boolean:
+		// Not by identity first, NaN is not equal to itself
+		return left.(Hashable).Equal(right)
+	}
+	if left == right {
+		return true
+	}
+	switch left := left.(type) {
+	case *Null:
+		_, ok := right.(*Null)
+		return ok
+	case *Array:
+		right, ok := right.(*Array)
+		if !ok || len(left.Elements) != len(right.Elements) {
+			return false
+		}
+		pair := [2]Object{left, right}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for i, element := range left.Elements {
+			if !equal(element, right.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		right, ok := right.(*Hash)
+		if !ok || left.Len() != right.Len() {
+			return false
+		}
+		pair := [2]Object{left, right}
+		if comparing[pair] {
+			return true
+		}
+		comparing[pair] = true
+		defer delete(comparing, pair)
+		for _, leftPair := range left.pairs {
+			rightValue, ok := right.Get(leftPair.Key)
+			if !ok || !equal(leftPair.Value, rightValue, comparing) {
+				return false
+			}
+		}
+		return true
+	default:
+		// Functions and builtins are compared by identity
+		return false
+	}
+}
@@ -4,24 +4,33 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	STRING_OBJ       = "STRING"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUES"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
 	BULITIN_OBJ      = "BUILTIN"
 	ARRAY_OBJ        = "ARRAY"
 	HASH_OBJ         = "HASH"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
 )
 
 type HashKey struct {
@@ -34,8 +43,16 @@ type Object interface {
 	Inspect() string
 }
 
+/*
+Hashable objects can be used as hash keys. Equal keys must have the same
+HashKey, but different keys may share one: hashes compare the keys of a
+HashKey with Equal, so a collision never replaces another pair.
+*/
 type Hashable interface {
+	Object
 	HashKey() HashKey
+	// Equal reports whether other is the same key
+	Equal(other Object) bool
 }
 
 type Integer struct {
@@ -53,6 +70,61 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: INTEGER_OBJ, Value: uint64(i.Value)}
 }
 
+// Equal compares with floats exactly, the integer isn't rounded to a float64
+func (i *Integer) Equal(other Object) bool {
+	switch other := other.(type) {
+	case *Integer:
+		return i.Value == other.Value
+	case *Float:
+		return other.isInteger() && int64(other.Value) == i.Value
+	default:
+		return false
+	}
+}
+
+type Float struct {
+	Value float64
+}
+
+// Inspect always shows a fraction or an exponent, so floats can be told from integers
+func (f *Float) Inspect() string {
+	out := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(out, ".eIN") {
+		out += ".0"
+	}
+	return out
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// HashKey of a float with an integral value is the one of the equal integer,
+// since `1 == 1.0` they must find the same hash entry
+func (f *Float) HashKey() HashKey {
+	if f.isInteger() {
+		return (&Integer{Value: int64(f.Value)}).HashKey()
+	}
+	return HashKey{Type: FLOAT_OBJ, Value: math.Float64bits(f.Value)}
+}
+
+// Equal is false for NaN like `==`, so NaN keys are never found
+func (f *Float) Equal(other Object) bool {
+	switch other := other.(type) {
+	case *Float:
+		return f.Value == other.Value
+	case *Integer:
+		return other.Equal(f)
+	default:
+		return false
+	}
+}
+
+// isInteger reports whether the value is integral and fits an Integer
+func (f *Float) isInteger() bool {
+	return f.Value == math.Trunc(f.Value) && f.Value >= math.MinInt64 && f.Value < math.MaxInt64
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -72,9 +144,20 @@ func (b *Boolean) HashKey() HashKey {
 	}
 	return HashKey{Type: BOOLEAN_OBJ, Value: value}
 }
+func (b *Boolean) Equal(other Object) bool {
+	otherBoolean, ok := other.(*Boolean)
+	return ok && b.Value == otherBoolean.Value
+}
 
 type Null struct{}
 
+// Booleans and null are compared by identity, the engines and conversions share these values
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 func (n *Null) Type() ObjectType {
 	return NULL_OBJ
 }
@@ -97,8 +180,39 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+// Break and Continue leave the blocks up to the enclosing loop, like ReturnValue does up to the function
+type Break struct{}
+
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+type Continue struct{}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
+// Frame is a function call the error propagated through
+type Frame struct {
+	// Name of the function, or of the binding it was called through
+	Function string
+	// Position of the call expression
+	CallSite token.Position
+}
+
 type Error struct {
 	Message string
+	// Where the error happened
+	Pos token.Position
+	// Calls the error propagated through, innermost first
+	Stack []Frame
 }
 
 func (e *Error) Type() ObjectType {
@@ -108,11 +222,47 @@ func (e *Error) Inspect() string {
 	return "ERROR: " + e.Message
 }
 
+// Error lets runtime errors be returned as Go errors, e.g. by the vm
+func (e *Error) Error() string {
+	return e.Message
+}
+
+/*
+StackTrace renders the error with its position and call stack, e.g.
+
+	ERROR: type mismatch: INTEGER + BOOLEAN
+	  at script.mk:2:5
+	  in add, called at script.mk:4:1
+*/
+func (e *Error) StackTrace() string {
+	var out bytes.Buffer
+	out.WriteString(e.Inspect())
+	if e.Pos.IsValid() {
+		out.WriteString("\n  at " + e.Pos.String())
+	}
+	for i := 0; i < len(e.Stack); i++ {
+		frame := e.Stack[i]
+		out.WriteString(fmt.Sprintf("\n  in %s, called at %s", frame.Function, frame.CallSite))
+		// Deep recursion would otherwise print the same frame thousands of times
+		repeated := 0
+		for i+1 < len(e.Stack) && e.Stack[i+1] == frame {
+			repeated++
+			i++
+		}
+		if repeated > 0 {
+			out.WriteString(fmt.Sprintf("\n  ... repeated %d more times", repeated))
+		}
+	}
+	return out.String()
+}
+
 func NewError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
 
 type Function struct {
+	// Name the function was defined with, empty for anonymous functions
+	Name       string
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	/*
@@ -155,11 +305,34 @@ func (s *String) HashKey() HashKey {
 	h.Write([]byte(s.Value))
 	return HashKey{Type: STRING_OBJ, Value: h.Sum64()}
 }
+func (s *String) Equal(other Object) bool {
+	otherString, ok := other.(*String)
+	return ok && s.Value == otherString.Value
+}
 
 type BuiltInFunction func(args ...Object) Object
 
+// Caller is implemented by the engines to let builtins call functions, see CallerFunction
+type Caller interface {
+	// Call calls a function or a builtin, errors are returned as *Error
+	Call(function Object, args ...Object) Object
+}
+
+// CallerFunction is a builtin calling back into the engine running it, e.g. `map`
+type CallerFunction func(caller Caller, args ...Object) Object
+
 type BuiltIn struct {
 	Fn BuiltInFunction
+	// Used instead of Fn when set
+	CallerFn CallerFunction
+}
+
+// Call runs the builtin, caller is only used by builtins with a CallerFn
+func (b *BuiltIn) Call(caller Caller, args ...Object) Object {
+	if b.CallerFn != nil {
+		return b.CallerFn(caller, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *BuiltIn) Type() ObjectType {
@@ -177,14 +350,45 @@ func (a *Array) Type() ObjectType {
 	return ARRAY_OBJ
 }
 func (a *Array) Inspect() string {
+	return inspect(a, map[Object]bool{})
+}
+
+/*
+inspect renders the arrays and hashes obj is already inside of as [...] and
+{...}, index assignment can make them contain themselves.
+*/
+func inspect(obj Object, visiting map[Object]bool) string {
 	var out bytes.Buffer
-	elements := []string{}
-	for _, e := range a.Elements {
-		elements = append(elements, e.Inspect())
+	switch obj := obj.(type) {
+	case *Array:
+		if visiting[obj] {
+			return "[...]"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, visiting))
+		}
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString("]")
+	case *Hash:
+		if visiting[obj] {
+			return "{...}"
+		}
+		visiting[obj] = true
+		defer delete(visiting, obj)
+		pairs := []string{}
+		for _, pair := range obj.pairs {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", inspect(pair.Key, visiting), inspect(pair.Value, visiting)))
+		}
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+	default:
+		return obj.Inspect()
 	}
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
 	return out.String()
 }
 
@@ -192,37 +396,185 @@ type HashPair struct {
 	Key   Object
 	Value Object
 }
+
+// Hash keeps its pairs in insertion order, so iterating and printing it is deterministic
 type Hash struct {
-	Pairs map[HashKey]HashPair
+	pairs []HashPair
+	// Indexes in pairs of the keys of each HashKey, more than one when HashKeys collide
+	index map[HashKey][]int
+}
+
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey][]int)}
 }
 
 func (h *Hash) Type() ObjectType {
 	return HASH_OBJ
 }
 func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-	pairs := []string{}
-	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	return inspect(h, map[Object]bool{})
+}
+
+func (h *Hash) Len() int {
+	return len(h.pairs)
+}
+
+// Pairs returns the pairs in insertion order
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, len(h.pairs))
+	copy(pairs, h.pairs)
+	return pairs
+}
+
+// Get returns the value of key, keys that are not Hashable are never found
+func (h *Hash) Get(key Object) (Object, bool) {
+	i, ok := h.find(key)
+	if !ok {
+		return nil, false
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
+	return h.pairs[i].Value, true
+}
+
+// Set adds a pair, or replaces the value of an existing key without moving it
+func (h *Hash) Set(key, value Object) *Error {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return NewError("unusable as hash key: %s", key.Type())
+	}
+	if i, ok := h.find(key); ok {
+		h.pairs[i].Value = value
+		return nil
+	}
+	hashKey := hashable.HashKey()
+	h.index[hashKey] = append(h.index[hashKey], len(h.pairs))
+	h.pairs = append(h.pairs, HashPair{Key: key, Value: value})
+	return nil
+}
+
+// Delete removes key and reports whether it was present
+func (h *Hash) Delete(key Object) bool {
+	i, ok := h.find(key)
+	if !ok {
+		return false
+	}
+	h.pairs = append(h.pairs[:i], h.pairs[i+1:]...)
+	// The indexes of the later pairs change, rebuild the index
+	h.index = make(map[HashKey][]int, len(h.index))
+	for j, pair := range h.pairs {
+		hashKey := pair.Key.(Hashable).HashKey()
+		h.index[hashKey] = append(h.index[hashKey], j)
+	}
+	return true
+}
+
+// Copy returns a hash with the same pairs, the values are not copied
+func (h *Hash) Copy() *Hash {
+	hash := &Hash{pairs: h.Pairs(), index: make(map[HashKey][]int, len(h.index))}
+	for hashKey, indexes := range h.index {
+		hash.index[hashKey] = append([]int(nil), indexes...)
+	}
+	return hash
+}
+
+// find returns the index in pairs of key
+func (h *Hash) find(key Object) (int, bool) {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return 0, false
+	}
+	for _, i := range h.index[hashable.HashKey()] {
+		if hashable.Equal(h.pairs[i].Key) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// CompiledFunction is a function compiled to bytecode, it only lives in the
+// constant pool and is wrapped in a Closure at runtime
+type CompiledFunction struct {
+	Name          string
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	// Source positions by instruction offset
+	Positions map[int]token.Position
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+/*
+Cell holds a variable captured by closures. While the function defining the
+variable runs, the cell refers to the variable's stack slot. When the function
+returns the cell is closed and keeps its own copy of the value.
+*/
+type Cell struct {
+	ref    *Object
+	closed Object
+}
+
+// NewCell creates an open cell referring to a stack slot
+func NewCell(slot *Object) *Cell {
+	return &Cell{ref: slot}
+}
+
+// NewClosedCell creates a cell holding value
+func NewClosedCell(value Object) *Cell {
+	cell := &Cell{closed: value}
+	cell.ref = &cell.closed
+	return cell
+}
+
+func (c *Cell) Get() Object {
+	return *c.ref
+}
+
+func (c *Cell) Set(value Object) {
+	*c.ref = value
+}
+
+// Close copies the value out of the stack slot
+func (c *Cell) Close() {
+	c.closed = *c.ref
+	c.ref = &c.closed
+}
+
+// Type is the same as for evaluated functions, so both engines report the same types
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
 }
 
 // Compile time checks
 
 var _ Object = (*Integer)(nil)
+var _ Object = (*Float)(nil)
 var _ Object = (*Boolean)(nil)
 var _ Object = (*Null)(nil)
 var _ Object = (*ReturnValue)(nil)
+var _ Object = (*Break)(nil)
+var _ Object = (*Continue)(nil)
 var _ Object = (*Error)(nil)
 var _ Object = (*Function)(nil)
 var _ Object = (*String)(nil)
 var _ Object = (*BuiltIn)(nil)
 var _ Object = (*Array)(nil)
 var _ Object = (*Hash)(nil)
+var _ Object = (*CompiledFunction)(nil)
+var _ Object = (*Closure)(nil)
 var _ Hashable = (*String)(nil)
 var _ Hashable = (*Integer)(nil)
+var _ Hashable = (*Float)(nil)
 var _ Hashable = (*Boolean)(nil)
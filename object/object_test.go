@@ -1,6 +1,15 @@
 package object
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
 
 func TestStringHaskKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -20,3 +29,487 @@ func TestStringHaskKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestFloatHashKey(t *testing.T) {
+	if (&Float{Value: 1.5}).HashKey() != (&Float{Value: 1.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	if (&Float{Value: 1.5}).HashKey() == (&Float{Value: 2.5}).HashKey() {
+		t.Errorf("floats with different values have same hash keys")
+	}
+	if (&Float{Value: 2}).HashKey() != (&Integer{Value: 2}).HashKey() {
+		t.Errorf("integral float and equal integer have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	testCases := []struct {
+		value    float64
+		expected string
+	}{
+		{1.5, "1.5"},
+		{2, "2.0"},
+		{-0.25, "-0.25"},
+		{1e-9, "1e-09"},
+	}
+	for _, testCase := range testCases {
+		received := (&Float{Value: testCase.value}).Inspect()
+		if received != testCase.expected {
+			t.Errorf("Expected %s, received %s", testCase.expected, received)
+		}
+	}
+}
+
+func TestStackTraceCollapsesRepeatedFrames(t *testing.T) {
+	recursive := Frame{Function: "f", CallSite: token.Position{Line: 1, Column: 15}}
+	err := &Error{
+		Message: "maximum call depth exceeded (3)",
+		Pos:     token.Position{Line: 1, Column: 15},
+		Stack:   []Frame{recursive, recursive, recursive, {Function: "f", CallSite: token.Position{Line: 2, Column: 1}}},
+	}
+	expected := `ERROR: maximum call depth exceeded (3)
+  at 1:15
+  in f, called at 1:15
+  ... repeated 2 more times
+  in f, called at 2:1`
+	if err.StackTrace() != expected {
+		t.Errorf("Expected stack trace:\n%s\nreceived:\n%s", expected, err.StackTrace())
+	}
+}
+
+type convertedUser struct {
+	Name    string   `monkey:"name"`
+	Age     int      `monkey:"age"`
+	Tags    []string `monkey:"tags"`
+	Manager *convertedUser
+	Secret  string `monkey:"-"`
+	private int
+}
+
+func TestFromGo(t *testing.T) {
+	boss := &convertedUser{Name: "bo"}
+	selfManaged := &convertedUser{Name: "al"}
+	selfManaged.Manager = selfManaged
+	selfContaining := []any{nil}
+	selfContaining[0] = selfContaining
+	selfMapping := map[string]any{}
+	selfMapping["m"] = selfMapping
+	testCases := []struct {
+		value    any
+		expected string
+	}{
+		{nil, "null"},
+		{42, "42"},
+		{uint8(7), "7"},
+		{2.5, "2.5"},
+		{float32(0.5), "0.5"},
+		{"hi", "hi"},
+		{true, "true"},
+		{[]int{1, 2}, "[1, 2]"},
+		{[2]string{"a", "b"}, "[a, b]"},
+		{[]any{1, "a", nil}, "[1, a, null]"},
+		{map[string]int{"one": 1}, "{one: 1}"},
+		{map[int]bool{1: true}, "{1: true}"},
+		{map[string]int{"b": 2, "c": 3, "a": 1}, "{a: 1, b: 2, c: 3}"},
+		{(*int)(nil), "null"},
+		{&Integer{Value: 3}, "3"},
+		{convertedUser{Name: "ada", Age: 36, Secret: "x"}, "{name: ada, age: 36, tags: null, Manager: null}"},
+		{[]*convertedUser{boss, boss}, "[{name: bo, age: 0, tags: null, Manager: null}, {name: bo, age: 0, tags: null, Manager: null}]"},
+	}
+	for _, testCase := range testCases {
+		obj, err := FromGo(testCase.value)
+		if err != nil {
+			t.Errorf("FromGo(%#v): unexpected error %s", testCase.value, err)
+			continue
+		}
+		if obj.Inspect() != testCase.expected {
+			t.Errorf("FromGo(%#v): expected %s, received %s", testCase.value, testCase.expected, obj.Inspect())
+		}
+	}
+
+	for _, value := range []any{make(chan int), uint64(math.MaxUint64), map[string]any{"x": complex(1, 2)}, selfManaged, selfContaining, selfMapping} {
+		if _, err := FromGo(value); err == nil {
+			t.Errorf("FromGo(%#v): expected an error", value)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	hash, _ := FromGo(map[string]any{"a": 1, "b": []any{true, "x"}})
+	mixedHash, _ := FromGo(map[any]any{1: "one", "two": 2.0})
+	testCases := []struct {
+		obj      Object
+		expected any
+	}{
+		{NULL, nil},
+		{&Integer{Value: 1}, int64(1)},
+		{&Float{Value: 1.5}, 1.5},
+		{&String{Value: "s"}, "s"},
+		{FALSE, false},
+		{&Array{Elements: []Object{&Integer{Value: 1}, NULL}}, []any{int64(1), nil}},
+		{hash, map[string]any{"a": int64(1), "b": []any{true, "x"}}},
+		{mixedHash, map[any]any{int64(1): "one", "two": 2.0}},
+	}
+	for _, testCase := range testCases {
+		value, err := ToGo(testCase.obj)
+		if err != nil {
+			t.Errorf("ToGo(%s): unexpected error %s", testCase.obj.Inspect(), err)
+			continue
+		}
+		if !reflect.DeepEqual(value, testCase.expected) {
+			t.Errorf("ToGo(%s): expected %#v, received %#v", testCase.obj.Inspect(), testCase.expected, value)
+		}
+	}
+}
+
+func TestSelfReferentialContainers(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}}
+	array.Elements[0] = array
+	hash := NewHash()
+	hash.Set(&String{Value: "k"}, hash)
+	testCases := []struct {
+		obj      Object
+		expected string
+	}{
+		{array, "[[...]]"},
+		{hash, "{k: {...}}"},
+		{&Array{Elements: []Object{hash, hash}}, "[{k: {...}}, {k: {...}}]"},
+	}
+	for _, testCase := range testCases {
+		if received := testCase.obj.Inspect(); received != testCase.expected {
+			t.Errorf("Expected %s, received %s", testCase.expected, received)
+		}
+		if _, err := ToGo(testCase.obj); err == nil {
+			t.Errorf("ToGo(%s): expected error, received none", testCase.expected)
+		}
+	}
+	var target []any
+	if _, err := toType(array, reflect.TypeOf(target)); err == nil {
+		t.Errorf("Expected error converting %s to %T, received none", array.Inspect(), target)
+	}
+}
+
+type ConvertedBase struct {
+	X int `monkey:"x"`
+}
+
+type convertedEmbedding struct {
+	*ConvertedBase
+	Name string `monkey:"name"`
+}
+
+type hiddenBase struct {
+	Y int `monkey:"y"`
+}
+
+type convertedHiddenEmbedding struct {
+	*hiddenBase
+}
+
+func TestNilEmbeddedPointers(t *testing.T) {
+	testCases := []struct {
+		value    any
+		expected string
+	}{
+		{convertedEmbedding{Name: "n"}, "{name: n}"},
+		{convertedEmbedding{ConvertedBase: &ConvertedBase{X: 1}, Name: "n"}, "{x: 1, name: n}"},
+		{convertedHiddenEmbedding{}, "{}"},
+	}
+	for _, testCase := range testCases {
+		obj, err := FromGo(testCase.value)
+		if err != nil {
+			t.Errorf("FromGo(%#v): unexpected error %s", testCase.value, err)
+			continue
+		}
+		if obj.Inspect() != testCase.expected {
+			t.Errorf("FromGo(%#v): expected %s, received %s", testCase.value, testCase.expected, obj.Inspect())
+		}
+	}
+
+	hash, _ := FromGo(map[string]any{"x": 2, "name": "m"})
+	value, err := toType(hash, reflect.TypeOf(convertedEmbedding{}))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	embedding := value.Interface().(convertedEmbedding)
+	if embedding.ConvertedBase == nil || embedding.X != 2 || embedding.Name != "m" {
+		t.Errorf("Expected {X: 2, Name: m}, received %+v", embedding)
+	}
+	hash, _ = FromGo(map[string]any{"y": 1})
+	if _, err := toType(hash, reflect.TypeOf(convertedHiddenEmbedding{})); err == nil {
+		t.Errorf("Expected an error setting a field of an unexported nil embedded pointer")
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	describe, err := WrapFunc(func(user convertedUser) string {
+		manager := "none"
+		if user.Manager != nil {
+			manager = user.Manager.Name
+		}
+		return fmt.Sprintf("%s (%d) %v, manager %s", user.Name, user.Age, user.Tags, manager)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	sum, _ := WrapFunc(func(first float64, rest ...int) float64 {
+		for _, n := range rest {
+			first += float64(n)
+		}
+		return first
+	})
+	check, _ := WrapFunc(func(ok bool) error {
+		if !ok {
+			return errors.New("check failed")
+		}
+		return nil
+	})
+	identity, _ := WrapFunc(func(obj Object, value any) []any { return []any{obj, value} })
+	small, _ := WrapFunc(func(n int8, u uint) {})
+
+	manager, _ := FromGo(map[string]any{"name": "grace"})
+	user, _ := FromGo(map[string]any{"name": "ada", "age": 36, "tags": []string{"math"}, "Manager": manager})
+	badUser, _ := FromGo(map[string]any{"age": "old"})
+
+	testCases := []struct {
+		fn       *BuiltIn
+		args     []Object
+		expected string
+	}{
+		{describe, []Object{user}, "ada (36) [math], manager grace"},
+		{describe, []Object{badUser}, "ERROR: argument 1: field age: cannot convert STRING to int"},
+		{describe, []Object{}, "ERROR: wrong number of arguments: received 0, expected 1"},
+		{sum, []Object{&Integer{Value: 1}}, "1.0"},
+		{sum, []Object{&Float{Value: 0.5}, &Integer{Value: 1}, &Integer{Value: 2}}, "3.5"},
+		{sum, []Object{&Float{Value: 0.5}, &Float{Value: 1}}, "ERROR: argument 2: cannot convert FLOAT to int"},
+		{sum, []Object{}, "ERROR: wrong number of arguments: received 0, expected at least 1"},
+		{check, []Object{TRUE}, "null"},
+		{check, []Object{FALSE}, "ERROR: check failed"},
+		{identity, []Object{&String{Value: "x"}, &Integer{Value: 2}}, "[x, 2]"},
+		{small, []Object{&Integer{Value: 300}, &Integer{Value: 1}}, "ERROR: argument 1: 300 overflows int8"},
+		{small, []Object{&Integer{Value: 1}, &Integer{Value: -1}}, "ERROR: argument 2: -1 overflows uint"},
+	}
+	for i, testCase := range testCases {
+		received := testCase.fn.Fn(testCase.args...).Inspect()
+		if received != testCase.expected {
+			t.Errorf("tests[%d]: expected %s, received %s", i, testCase.expected, received)
+		}
+	}
+
+	if _, err := WrapFunc(func() (int, int) { return 0, 0 }); err == nil {
+		t.Errorf("Expected an error for funcs with two non-error results")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	builtIn := func(value int64) *BuiltIn {
+		return &BuiltIn{Fn: func(args ...Object) Object { return &Integer{Value: value} }}
+	}
+	core := NewRegistry()
+	core.Register(BuiltinSpec{Name: "one", BuiltIn: builtIn(1), Arity: 0})
+	core.Register(BuiltinSpec{Name: "two", BuiltIn: builtIn(2), Arity: 0})
+	extra := NewRegistry()
+	extra.Register(BuiltinSpec{Name: "two", BuiltIn: builtIn(22), Arity: 0})
+	extra.Register(BuiltinSpec{Name: "three", BuiltIn: builtIn(3), Arity: 0})
+
+	combined := NewRegistry(core, extra)
+	combined.Remove("one")
+	if names := strings.Join(combined.Names(), ","); names != "three,two" {
+		t.Errorf("Expected names three,two, received %s", names)
+	}
+	two, ok := combined.Lookup("two")
+	if !ok || two.Fn().Inspect() != "22" {
+		t.Errorf("Expected later sets to override earlier ones, received %v", two)
+	}
+	if _, ok := core.Lookup("one"); !ok {
+		t.Errorf("Expected combining registries to leave them unchanged")
+	}
+	if _, ok := combined.Lookup("one"); ok {
+		t.Errorf("Expected one to be removed")
+	}
+}
+
+func TestBuiltinSpecSignature(t *testing.T) {
+	testCases := []struct {
+		spec     BuiltinSpec
+		expected string
+	}{
+		{BuiltinSpec{Name: "now"}, "now()"},
+		{
+			BuiltinSpec{
+				Name:   "push",
+				Arity:  2,
+				Params: []Param{{Name: "array", Types: []ObjectType{ARRAY_OBJ}}, {Name: "value"}},
+			},
+			"push(array: ARRAY, value)",
+		},
+		{
+			BuiltinSpec{
+				Name:   "len",
+				Arity:  1,
+				Params: []Param{{Name: "value", Types: []ObjectType{STRING_OBJ, ARRAY_OBJ}}},
+			},
+			"len(value: STRING|ARRAY)",
+		},
+		{BuiltinSpec{Name: "print", Arity: VARIADIC}, "print(...)"},
+	}
+	for _, testCase := range testCases {
+		if signature := testCase.spec.Signature(); signature != testCase.expected {
+			t.Errorf("Expected %s, received %s", testCase.expected, signature)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	hash := NewHash()
+	for i, key := range []string{"c", "a", "b"} {
+		hash.Set(&String{Value: key}, &Integer{Value: int64(i)})
+	}
+	hash.Set(&String{Value: "a"}, &Integer{Value: 10})
+	if hash.Inspect() != "{c: 0, a: 10, b: 2}" {
+		t.Errorf("Expected replaced values to keep their position, received %s", hash.Inspect())
+	}
+
+	copied := hash.Copy()
+	if !copied.Delete(&String{Value: "c"}) || copied.Delete(&String{Value: "c"}) {
+		t.Errorf("Expected c to be deleted once")
+	}
+	copied.Set(&String{Value: "d"}, NULL)
+	if copied.Inspect() != "{a: 10, b: 2, d: null}" {
+		t.Errorf("Expected {a: 10, b: 2, d: null}, received %s", copied.Inspect())
+	}
+	if value, ok := copied.Get(&String{Value: "b"}); !ok || value.Inspect() != "2" {
+		t.Errorf("Expected b to be found after deleting an earlier key, received %v", value)
+	}
+	if hash.Len() != 3 {
+		t.Errorf("Expected the copy to be independent, received %s", hash.Inspect())
+	}
+
+	if errObj := hash.Set(&Array{}, NULL); errObj == nil || errObj.Message != "unusable as hash key: ARRAY" {
+		t.Errorf("Expected unusable as hash key error, received %v", errObj)
+	}
+	if _, ok := hash.Get(&Array{}); ok {
+		t.Errorf("Expected arrays never to be found")
+	}
+}
+
+// collidingKey has the same HashKey for all its values
+type collidingKey struct {
+	name string
+}
+
+func (k *collidingKey) Type() ObjectType { return "COLLIDING_KEY" }
+func (k *collidingKey) Inspect() string  { return k.name }
+func (k *collidingKey) HashKey() HashKey { return HashKey{Type: "COLLIDING_KEY", Value: 1} }
+func (k *collidingKey) Equal(other Object) bool {
+	otherKey, ok := other.(*collidingKey)
+	return ok && k.name == otherKey.name
+}
+
+func TestHashCollisions(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&collidingKey{"a"}, &Integer{Value: 1})
+	hash.Set(&collidingKey{"b"}, &Integer{Value: 2})
+	hash.Set(&collidingKey{"c"}, &Integer{Value: 3})
+	hash.Set(&collidingKey{"b"}, &Integer{Value: 20})
+	if hash.Inspect() != "{a: 1, b: 20, c: 3}" {
+		t.Errorf("Expected colliding keys to be kept apart, received %s", hash.Inspect())
+	}
+
+	hash.Delete(&collidingKey{"a"})
+	for _, testCase := range []struct {
+		key      string
+		expected string
+	}{{"b", "20"}, {"c", "3"}} {
+		value, ok := hash.Get(&collidingKey{testCase.key})
+		if !ok || value.Inspect() != testCase.expected {
+			t.Errorf("Key %s: expected %s, received %v", testCase.key, testCase.expected, value)
+		}
+	}
+	if _, ok := hash.Get(&collidingKey{"a"}); ok {
+		t.Errorf("Expected a to be deleted")
+	}
+	if _, ok := hash.Get(&collidingKey{"d"}); ok {
+		t.Errorf("Expected d not to be found")
+	}
+}
+
+func TestHashableEqual(t *testing.T) {
+	testCases := []struct {
+		left     Hashable
+		right    Object
+		expected bool
+	}{
+		{&Integer{Value: 2}, &Integer{Value: 2}, true},
+		{&Integer{Value: 2}, &Float{Value: 2}, true},
+		{&Float{Value: 2}, &Integer{Value: 2}, true},
+		{&Integer{Value: 2}, &Float{Value: 2.5}, false},
+		{&Integer{Value: 1 << 53}, &Float{Value: 1 << 53}, true},
+		{&Integer{Value: 1<<53 + 1}, &Float{Value: 1 << 53}, false},
+		{&Float{Value: math.NaN()}, &Float{Value: math.NaN()}, false},
+		{&String{Value: "1"}, &Integer{Value: 1}, false},
+		{&String{Value: "a"}, &String{Value: "a"}, true},
+		{TRUE, &Boolean{Value: true}, true},
+		{TRUE, &Integer{Value: 1}, false},
+	}
+	for _, testCase := range testCases {
+		if received := testCase.left.Equal(testCase.right); received != testCase.expected {
+			t.Errorf("%s.Equal(%s): expected %t, received %t", testCase.left.Inspect(), testCase.right.Inspect(), testCase.expected, received)
+		}
+		// Equal keys must share a HashKey
+		if hashable, ok := testCase.right.(Hashable); ok && testCase.expected && testCase.left.HashKey() != hashable.HashKey() {
+			t.Errorf("%s and %s are equal but have different HashKeys", testCase.left.Inspect(), testCase.right.Inspect())
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash()
+		for i := 0; i < len(pairs); i += 2 {
+			h.Set(pairs[i], pairs[i+1])
+		}
+		return h
+	}
+	one, two := &Integer{Value: 1}, &Integer{Value: 2}
+	builtIn := &BuiltIn{Fn: func(args ...Object) Object { return NULL }}
+	selfA := &Array{Elements: []Object{one}}
+	selfA.Elements = append(selfA.Elements, selfA)
+	selfB := &Array{Elements: []Object{one}}
+	selfB.Elements = append(selfB.Elements, selfB)
+
+	testCases := []struct {
+		name     string
+		left     Object
+		right    Object
+		expected bool
+	}{
+		{"integers", one, &Integer{Value: 1}, true},
+		{"integer and float", one, &Float{Value: 1}, true},
+		{"integer and rounded float", &Integer{Value: 1<<53 + 1}, &Float{Value: 1 << 53}, false},
+		{"float and rounded integer", &Float{Value: 1 << 53}, &Integer{Value: 1<<53 + 1}, false},
+		{"arrays of integer and rounded float", &Array{Elements: []Object{&Integer{Value: 1<<53 + 1}}}, &Array{Elements: []Object{&Float{Value: 1 << 53}}}, false},
+		{"NaN", &Float{Value: math.NaN()}, &Float{Value: math.NaN()}, false},
+		{"null", NULL, &Null{}, true},
+		{"null and false", NULL, FALSE, false},
+		{"arrays", &Array{Elements: []Object{one, two}}, &Array{Elements: []Object{one, &Float{Value: 2}}}, true},
+		{"array order", &Array{Elements: []Object{one, two}}, &Array{Elements: []Object{two, one}}, false},
+		{"array lengths", &Array{Elements: []Object{one}}, &Array{Elements: []Object{one, one}}, false},
+		{"nested arrays", &Array{Elements: []Object{&Array{}}}, &Array{Elements: []Object{&Array{}}}, true},
+		{"hash pair order", hash(one, TRUE, two, FALSE), hash(two, FALSE, one, TRUE), true},
+		{"hash values", hash(one, TRUE), hash(one, FALSE), false},
+		{"hash keys", hash(one, TRUE), hash(two, TRUE), false},
+		{"array and hash", &Array{}, NewHash(), false},
+		{"same builtin", builtIn, builtIn, true},
+		{"different builtins", builtIn, &BuiltIn{Fn: builtIn.Fn}, false},
+		{"arrays containing themselves", selfA, selfB, true},
+	}
+	for _, testCase := range testCases {
+		if received := Equal(testCase.left, testCase.right); received != testCase.expected {
+			t.Errorf("%s: expected %t, received %t", testCase.name, testCase.expected, received)
+		}
+		if received := Equal(testCase.right, testCase.left); received != testCase.expected {
+			t.Errorf("%s reversed: expected %t, received %t", testCase.name, testCase.expected, received)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package object
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Arity of builtins taking any number of arguments
+const VARIADIC = -1
+
+// Param describes a parameter of a builtin, a nil Types accepts any type
+type Param struct {
+	Name  string
+	Types []ObjectType
+}
+
+// BuiltinSpec is a builtin together with the metadata shown to users
+type BuiltinSpec struct {
+	Name    string
+	BuiltIn *BuiltIn
+	// Number of arguments, VARIADIC when it varies
+	Arity  int
+	Params []Param
+	Doc    string
+}
+
+// Signature describes the parameters of the builtin, e.g. `len(value: STRING|ARRAY)`
+func (s BuiltinSpec) Signature() string {
+	params := make([]string, len(s.Params))
+	for i, param := range s.Params {
+		params[i] = param.Name
+		if len(param.Types) > 0 {
+			types := make([]string, len(param.Types))
+			for j, paramType := range param.Types {
+				types[j] = string(paramType)
+			}
+			params[i] += ": " + strings.Join(types, "|")
+		}
+	}
+	if s.Arity == VARIADIC {
+		params = append(params, "...")
+	}
+	return fmt.Sprintf("%s(%s)", s.Name, strings.Join(params, ", "))
+}
+
+/*
+Registry holds the builtins available to programs. Registries are attached to
+environments, so builtins can be added, removed or left out per interpreter.
+*/
+type Registry struct {
+	specs map[string]BuiltinSpec
+}
+
+// NewRegistry combines sets of builtins, later sets override earlier ones
+func NewRegistry(sets ...*Registry) *Registry {
+	r := &Registry{specs: make(map[string]BuiltinSpec)}
+	for _, set := range sets {
+		for name, spec := range set.specs {
+			r.specs[name] = spec
+		}
+	}
+	return r
+}
+
+// Register adds spec, replacing any builtin of the same name
+func (r *Registry) Register(spec BuiltinSpec) {
+	r.specs[spec.Name] = spec
+}
+
+func (r *Registry) Remove(names ...string) {
+	for _, name := range names {
+		delete(r.specs, name)
+	}
+}
+
+func (r *Registry) Lookup(name string) (*BuiltIn, bool) {
+	spec, ok := r.specs[name]
+	return spec.BuiltIn, ok
+}
+
+func (r *Registry) Spec(name string) (BuiltinSpec, bool) {
+	spec, ok := r.specs[name]
+	return spec, ok
+}
+
+// Names returns the names of the builtins in a stable order
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.specs))
+	for name := range r.specs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,107 @@
+package object
+
+import "context"
+
+// Call depth used when Limits.MaxCallDepth is zero, deep enough for most
+// recursive programs while staying far from overflowing the Go stack
+const DEFAULT_MAX_CALL_DEPTH = 10000
+
+// How many steps are taken between two checks of the context
+const contextCheckInterval = 1024
+
+// Limits bound the resources an evaluation can use, zero means no limit
+type Limits struct {
+	// Maximum number of evaluated nodes
+	MaxSteps int64
+	// Maximum depth of nested function calls, DEFAULT_MAX_CALL_DEPTH when zero
+	MaxCallDepth int
+	// Maximum number of array elements, hash pairs and string bytes created
+	MaxAllocations int64
+}
+
+/*
+Runtime is the state of an evaluation, shared by all the environments it
+uses. Its methods return an error once a limit is exceeded or the context is
+done, the nil Runtime has no limits.
+*/
+type Runtime struct {
+	ctx    context.Context
+	limits Limits
+
+	steps       int64
+	callDepth   int
+	allocations int64
+}
+
+func NewRuntime(ctx context.Context, limits Limits) *Runtime {
+	if limits.MaxCallDepth == 0 {
+		limits.MaxCallDepth = DEFAULT_MAX_CALL_DEPTH
+	}
+	return &Runtime{ctx: ctx, limits: limits}
+}
+
+func (r *Runtime) Context() context.Context {
+	if r == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r *Runtime) Step() *Error {
+	if r == nil {
+		return nil
+	}
+	r.steps++
+	if r.limits.MaxSteps > 0 && r.steps > r.limits.MaxSteps {
+		return NewError("step limit exceeded (%d)", r.limits.MaxSteps)
+	}
+	if r.steps%contextCheckInterval == 0 {
+		if err := r.ctx.Err(); err != nil {
+			return NewError("evaluation cancelled: %s", err)
+		}
+	}
+	return nil
+}
+
+// EnterCall must be paired with LeaveCall when it doesn't return an error
+func (r *Runtime) EnterCall() *Error {
+	if r == nil {
+		return nil
+	}
+	if r.callDepth >= r.limits.MaxCallDepth {
+		return NewError("maximum call depth exceeded (%d)", r.limits.MaxCallDepth)
+	}
+	r.callDepth++
+	return nil
+}
+
+func (r *Runtime) LeaveCall() {
+	if r != nil {
+		r.callDepth--
+	}
+}
+
+func (r *Runtime) Allocate(size int64) *Error {
+	if r == nil {
+		return nil
+	}
+	r.allocations += size
+	if r.limits.MaxAllocations > 0 && r.allocations > r.limits.MaxAllocations {
+		return NewError("allocation limit exceeded (%d)", r.limits.MaxAllocations)
+	}
+	return nil
+}
+
+// AllocationSize is what creating obj counts towards Limits.MaxAllocations
+func AllocationSize(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *Array:
+		return int64(len(obj.Elements))
+	case *Hash:
+		return int64(obj.Len())
+	case *String:
+		return int64(len(obj.Value))
+	default:
+		return 0
+	}
+}
@@ -2,9 +2,12 @@ package parser
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 	"strconv"
 
 	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
 	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
 	"github.com/zawlinnnaing/monkey-language-in-golang/token"
 )
@@ -13,57 +16,176 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN       // x = y, x += y
+	OR           // ||
+	AND          // &&
 	EQUALS       // == or !=
-	LESS_GREATER // > OR <
+	LESS_GREATER // >, <, >= or <=
+	BIT_OR       // |
+	BIT_XOR      // ^
+	BIT_AND      // &
+	SHIFT        // << or >>
 	SUM          // + or -
-	PRODUCT      // * or /
-	PREFIX       // -X or !X
+	PRODUCT      // *, / or %
+	PREFIX       // -X, !X or ~X
+	POWER        // x ** y, binds tighter than prefix operators: -2 ** 2 is -(2 ** 2)
 	CALL         // myFunction(x)
 	INDEX        // myArray[0]
 )
 
 var precedencesMap = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.ASTERISK: PRODUCT,
-	token.SLASH:    PRODUCT,
-	token.LT:       LESS_GREATER,
-	token.GT:       LESS_GREATER,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              OR,
+	token.AND:             AND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.ASTERISK:        PRODUCT,
+	token.SLASH:           PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LT:              LESS_GREATER,
+	token.GT:              LESS_GREATER,
+	token.LT_EQ:           LESS_GREATER,
+	token.GT_EQ:           LESS_GREATER,
+	token.PIPE:            BIT_OR,
+	token.CARET:           BIT_XOR,
+	token.AMPERSAND:       BIT_AND,
+	token.SHIFT_LEFT:      SHIFT,
+	token.SHIFT_RIGHT:     SHIFT,
+	token.LPAREN:          CALL,
+	token.LBRACKET:        INDEX,
 }
 
 type Parser struct {
 	lexer        *lexer.Lexer
 	currentToken token.Token
 	peekToken    token.Token
-	errors       []string
+	errors       []diagnostic.Diagnostic
+	// Set after an error until the parser resynchronizes, so that a single
+	// mistake doesn't produce a cascade of follow-up errors
+	panicking bool
+	// Number of loops enclosing the current statement in the current function
+	loopDepth int
 
 	prefixParsingFns map[token.TokenType]prefixParsingFn
 	infixParsingFns  map[token.TokenType]infixParsingFn
 }
 
 func (p *Parser) nextToken() {
+	switch p.currentToken.Type {
+	case token.SEMICOLON, token.COMMA, token.COLON, token.IN, token.ELSE:
+		p.carryComments()
+	}
 	p.currentToken = p.peekToken
 	p.peekToken = p.lexer.NextToken()
 }
 
+/*
+carryComments moves the comments of the current token onto the next one, for
+tokens the AST doesn't keep, so that tools can still find the comments.
+Punctuation only ever skipped is handled by nextToken, `=` and parentheses
+are only skipped in some places.
+*/
+func (p *Parser) carryComments() {
+	if len(p.currentToken.Comments) == 0 {
+		return
+	}
+	p.peekToken.Comments = slices.Concat(p.currentToken.Comments, p.peekToken.Comments)
+	p.currentToken.Comments = nil
+}
+
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 	for !p.currentTokenIs(token.EOF) {
+		start := p.currentToken
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicking {
+			// Broken statements are dropped, the rest of the program is kept
+			if p.synchronize(start) {
+				continue
+			}
+		} else if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
 		p.nextToken()
 	}
+	program.TrailingComments = p.currentToken.Comments
 
 	return program
 }
 
+/*
+synchronize skips tokens until the next statement boundary after a parse error.
+It stops on a `;` or on a token followed by a statement keyword, `fn` or `}`,
+skipping over nested blocks. A `}` closing an enclosing block is left as the
+current token for the block parser. When the error is on a statement keyword
+other than start, the token starting the failed statement, synchronize stops
+on it and reports that it starts the next statement.
+*/
+func (p *Parser) synchronize(start token.Token) bool {
+	p.panicking = false
+	depth := 0
+	for !p.currentTokenIs(token.EOF) {
+		if depth == 0 && p.currentToken.Pos != start.Pos && isSynchronizationPoint(p.currentToken.Type) {
+			return true
+		}
+		switch p.currentToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		}
+		if depth == 0 && p.peekIsSynchronizationPoint() {
+			return false
+		}
+		p.nextToken()
+	}
+	return false
+}
+
+func (p *Parser) peekIsSynchronizationPoint() bool {
+	return isSynchronizationPoint(p.peekToken.Type) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)
+}
+
+// isSynchronizationPoint reports whether a token of type t starts a statement
+func isSynchronizationPoint(t token.TokenType) bool {
+	switch t {
+	case token.LET, token.RETURN, token.WHILE, token.FOR, token.BREAK, token.CONTINUE, token.FUNCTION:
+		return true
+	}
+	return false
+}
+
+// skipOptionalSemicolon consumes a trailing `;`. Nothing is consumed after an
+// error, so that synchronize starts from where the error happened.
+func (p *Parser) skipOptionalSemicolon() {
+	if p.peekTokenIs(token.SEMICOLON) && !p.panicking {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) addError(d diagnostic.Diagnostic) {
+	if p.panicking {
+		return
+	}
+	p.errors = append(p.errors, d)
+	p.panicking = true
+}
+
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	statement := &ast.LetStatement{Token: p.currentToken}
 
@@ -77,14 +199,16 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
+	p.carryComments()
 
 	p.nextToken()
 	statement.Value = p.parseExpression(LOWEST)
-
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
+	if functionLiteral, ok := statement.Value.(*ast.FunctionLiteral); ok {
+		functionLiteral.Name = statement.Name.Value
 	}
 
+	p.skipOptionalSemicolon()
+
 	return statement
 }
 
@@ -114,20 +238,107 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
+func (p *Parser) parseWhileStatement() ast.Statement {
+	statement := &ast.WhileStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.carryComments()
+	p.nextToken()
+	statement.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	p.carryComments()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+	p.skipOptionalSemicolon()
+	return statement
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	statement := &ast.ForStatement{Token: p.currentToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.carryComments()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	statement.Variable = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+	p.nextToken()
+	statement.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	p.carryComments()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	statement.Body = p.parseLoopBody()
+	p.skipOptionalSemicolon()
+	return statement
+}
+
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loopDepth++
+	defer func() { p.loopDepth-- }()
+	return p.parseBlockStatements()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	statement := &ast.BreakStatement{Token: p.currentToken}
+	p.checkInsideLoop()
+	p.skipOptionalSemicolon()
+	return statement
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	statement := &ast.ContinueStatement{Token: p.currentToken}
+	p.checkInsideLoop()
+	p.skipOptionalSemicolon()
+	return statement
+}
+
+// checkInsideLoop reports a `break` or `continue` used outside of a loop. The
+// statement is well formed, so the parser doesn't need to resynchronize.
+func (p *Parser) checkInsideLoop() {
+	if p.loopDepth > 0 || p.panicking {
+		return
+	}
+	d := diagnostic.New(diagnostic.OUTSIDE_LOOP, p.currentToken.Span(), "%s outside of a loop", p.currentToken.Literal)
+	p.errors = append(p.errors, d)
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	statement := &ast.ReturnStatement{Token: p.currentToken}
 
 	p.nextToken()
 
 	statement.ReturnValue = p.parseExpression(LOWEST)
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipOptionalSemicolon()
 
 	return statement
 }
@@ -138,30 +349,29 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	}
 	statement.Expression = p.parseExpression(LOWEST)
 
-	if p.peekTokenIs(token.SEMICOLON) {
-		p.nextToken()
-	}
+	p.skipOptionalSemicolon()
 	return statement
 }
 
 func (p *Parser) parseGroupExpression() ast.Expression {
+	p.carryComments()
 	p.nextToken()
 	expression := p.parseExpression(LOWEST)
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	p.carryComments()
 	return expression
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefixParsingFn := p.prefixParsingFns[p.currentToken.Type]
 	if prefixParsingFn == nil {
-		errorMsg := fmt.Sprintf("No prefix parsing function for token: %s", p.currentToken.Type)
-		p.errors = append(p.errors, errorMsg)
+		p.noPrefixParsingFnError(p.currentToken)
 		return nil
 	}
 	left := prefixParsingFn()
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.getTokenPrecedence(p.peekToken) {
+	for !p.panicking && !p.peekTokenIs(token.SEMICOLON) && precedence < p.getTokenPrecedence(p.peekToken) {
 		infixParsingFn := p.infixParsingFns[p.peekToken.Type]
 		if infixParsingFn == nil {
 			return left
@@ -180,12 +390,14 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	p.carryComments()
 	p.nextToken()
 	expression.Condition = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	p.carryComments()
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
@@ -209,22 +421,68 @@ func (p *Parser) parseBlockStatements() *ast.BlockStatement {
 		Token:      p.currentToken,
 		Statements: []ast.Statement{},
 	}
+	if p.panicking {
+		// The enclosing statement is already broken, leave the block to its recovery
+		return blockStatement
+	}
 
 	p.nextToken()
 	for !p.currentTokenIs(token.RBRACE) && !p.currentTokenIs(token.EOF) {
+		start := p.currentToken
 		statement := p.parseStatement()
-		if statement != nil {
+		if p.panicking {
+			if p.synchronize(start) {
+				continue
+			}
+			if p.currentTokenIs(token.RBRACE) {
+				break
+			}
+		} else if statement != nil {
 			blockStatement.Statements = append(blockStatement.Statements, statement)
 		}
 		p.nextToken()
 	}
+	if p.currentTokenIs(token.RBRACE) {
+		blockStatement.RBrace = p.currentToken
+	}
 
 	return blockStatement
 }
 
 func (p *Parser) peekErrors(expectTokenType token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", expectTokenType, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := diagnostic.New(
+		diagnostic.UNEXPECTED_TOKEN,
+		p.peekToken.Span(),
+		"expected next token to be %s, got %s instead", expectTokenType, p.peekToken.Type,
+	)
+	d.Expected = []token.TokenType{expectTokenType}
+	d.Found = p.peekToken.Type
+	d.Hints = expectedTokenHints(expectTokenType)
+	p.addError(d)
+}
+
+func (p *Parser) noPrefixParsingFnError(tok token.Token) {
+	if tok.Type == token.ILLEGAL {
+		d := diagnostic.New(diagnostic.ILLEGAL_CHARACTER, tok.Span(), "illegal character %q", tok.Literal)
+		d.Found = tok.Type
+		p.addError(d)
+		return
+	}
+	d := diagnostic.New(diagnostic.EXPECTED_EXPR, tok.Span(), "expected an expression, got %s instead", tok.Type)
+	d.Found = tok.Type
+	p.addError(d)
+}
+
+func expectedTokenHints(expectTokenType token.TokenType) []string {
+	switch expectTokenType {
+	case token.IDENT:
+		return []string{"use a name such as `x` here"}
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		return []string{fmt.Sprintf("add a closing %q", expectTokenType)}
+	case token.LPAREN, token.LBRACE, token.ASSIGN, token.COLON:
+		return []string{fmt.Sprintf("insert %q here", expectTokenType)}
+	}
+	return nil
 }
 
 func (p *Parser) registerPrefixFn(token token.TokenType, fn prefixParsingFn) {
@@ -244,8 +502,20 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	literal := &ast.IntegerLiteral{Token: p.currentToken}
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
-		errorMsg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, errorMsg)
+		d := diagnostic.New(diagnostic.INVALID_INTEGER, p.currentToken.Span(), "could not parse %q as integer", p.currentToken.Literal)
+		p.addError(d)
+		return nil
+	}
+	literal.Value = value
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.currentToken}
+	value, err := strconv.ParseFloat(p.currentToken.Literal, 64)
+	if err != nil {
+		d := diagnostic.New(diagnostic.INVALID_FLOAT, p.currentToken.Span(), "could not parse %q as float", p.currentToken.Literal)
+		p.addError(d)
 		return nil
 	}
 	literal.Value = value
@@ -269,11 +539,36 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Operator: p.currentToken.Literal,
 	}
 	precedence := p.getTokenPrecedence(p.currentToken)
+	if infixExpression.Token.Type == token.POWER {
+		// Right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	infixExpression.Right = p.parseExpression(precedence)
 	return infixExpression
 }
 
+// parseAssignExpression parses the right hand side with a lower precedence, so
+// assignments are right associative: `a = b = 1` is `a = (b = 1)`
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.currentToken,
+		Target:   target,
+		Operator: p.currentToken.Literal,
+	}
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		d := diagnostic.New(diagnostic.INVALID_ASSIGN, target.Span(), "cannot assign to %s", target.String())
+		d.Hints = []string{"only variables declared with `let` and elements of arrays and hashes can be assigned"}
+		p.addError(d)
+		return nil
+	}
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+	return expression
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	exp := &ast.BooleanLiteral{
 		Token: p.currentToken,
@@ -293,11 +588,16 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
+	p.carryComments()
 	functionLiteral.Parameters = p.parseFunctionParameters()
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
+	// Loops around the function literal can't be left from its body
+	outerLoopDepth := p.loopDepth
+	p.loopDepth = 0
 	functionLiteral.Body = p.parseBlockStatements()
+	p.loopDepth = outerLoopDepth
 	return functionLiteral
 }
 
@@ -305,15 +605,20 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
+		p.carryComments()
 		return identifiers
 	}
 
-	p.nextToken()
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
 	identifiers = append(identifiers, p.parseIdentifier().(*ast.Identifier))
 	for p.peekTokenIs(token.COMMA) {
 		// Skips comma and reaches next parameter
 		p.nextToken()
-		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
 		identifiers = append(identifiers, p.parseIdentifier().(*ast.Identifier))
 	}
@@ -322,6 +627,7 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 		// After parsing all parameters, if right paren is not found, parse error
 		return nil
 	}
+	p.carryComments()
 
 	return identifiers
 }
@@ -329,6 +635,9 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.currentToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	if p.currentTokenIs(token.RPAREN) {
+		exp.RParen = p.currentToken
+	}
 	return exp
 }
 
@@ -355,6 +664,9 @@ func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	arrayLiteral := &ast.ArrayLiteral{Token: p.currentToken}
 	arrayLiteral.Elements = p.parseExpressionList(token.RBRACKET)
+	if p.currentTokenIs(token.RBRACKET) {
+		arrayLiteral.RBracket = p.currentToken
+	}
 	return arrayLiteral
 }
 
@@ -365,12 +677,13 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
+	indexExpression.RBracket = p.currentToken
 	return indexExpression
 }
 
 func (p *Parser) parseHashLiteral() ast.Expression {
 	hash := &ast.HashLiteral{Token: p.currentToken}
-	hash.Pairs = make(map[ast.Expression]ast.Expression)
+	hash.Pairs = []ast.HashPair{}
 
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
@@ -380,20 +693,16 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		}
 		p.nextToken()
 		value := p.parseExpression(LOWEST)
-		hash.Pairs[key] = value
-
-		if p.peekTokenIs(token.COMMA) {
-			p.nextToken()
-			continue
-		}
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
 
-		if !p.peekTokenIs(token.RBRACE) {
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
 	}
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.RBrace = p.currentToken
 
 	return hash
 }
@@ -406,14 +715,20 @@ func (p *Parser) getTokenPrecedence(token token.Token) int {
 	return precedence
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
+// Errors returns the lexer and parser diagnostics in source order
+func (p *Parser) Errors() []diagnostic.Diagnostic {
+	errors := append([]diagnostic.Diagnostic{}, p.lexer.Errors()...)
+	errors = append(errors, p.errors...)
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Span.Start.Offset < errors[j].Span.Start.Offset
+	})
+	return errors
 }
 
 func New(l *lexer.Lexer) *Parser {
 	p := Parser{
 		lexer:  l,
-		errors: []string{},
+		errors: []diagnostic.Diagnostic{},
 
 		prefixParsingFns: make(map[token.TokenType]prefixParsingFn),
 		infixParsingFns:  make(map[token.TokenType]infixParsingFn),
@@ -425,8 +740,10 @@ func New(l *lexer.Lexer) *Parser {
 
 	p.registerPrefixFn(token.IDENT, p.parseIdentifier)
 	p.registerPrefixFn(token.INT, p.parseIntegerLiteral)
+	p.registerPrefixFn(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixFn(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixFn(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefixFn(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefixFn(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefixFn(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefixFn(token.LPAREN, p.parseGroupExpression)
@@ -444,7 +761,23 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfixFn(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfixFn(token.GT, p.parseInfixExpression)
 	p.registerInfixFn(token.LT, p.parseInfixExpression)
+	p.registerInfixFn(token.PERCENT, p.parseInfixExpression)
+	p.registerInfixFn(token.POWER, p.parseInfixExpression)
+	p.registerInfixFn(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfixFn(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfixFn(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfixFn(token.PIPE, p.parseInfixExpression)
+	p.registerInfixFn(token.CARET, p.parseInfixExpression)
+	p.registerInfixFn(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfixFn(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfixFn(token.AND, p.parseInfixExpression)
+	p.registerInfixFn(token.OR, p.parseInfixExpression)
 	p.registerInfixFn(token.LPAREN, p.parseCallExpression)
+	p.registerInfixFn(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.SLASH_ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.LBRACKET, p.parseIndexExpression)
 
 	return &p
@@ -2,10 +2,13 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
 	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
 )
 
 func testExpressionStatement(t *testing.T, statement ast.Statement) bool {
@@ -260,6 +263,37 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5e3;", 2500},
+	}
+	for _, testCase := range testCases {
+		parser := New(lexer.New(testCase.input))
+		program := parser.ParseProgram()
+		checkParseErrors(t, parser)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("Expected program statements to be 1, received %d", len(program.Statements))
+		}
+		statement, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("Expected statement, received %T", program.Statements[0])
+		}
+		literal, ok := statement.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("Expected *ast.FloatLiteral, received %T", statement.Expression)
+		}
+		if literal.Value != testCase.expected {
+			t.Errorf("Expected value %g, received %g", testCase.expected, literal.Value)
+		}
+	}
+}
+
 func TestStringLiteralExpression(t *testing.T) {
 	input := `"hello world"`
 	lexer := lexer.New(input)
@@ -361,6 +395,23 @@ func TestOperatorPrecedenceString(t *testing.T) {
 		},
 		{"a * [1, 2, 3, 4][b * c] * d", "((a * ([1, 2, 3, 4][(b * c)])) * d)"},
 		{"add(a * b[2], b[1], 2 * [1, 2][1])", "add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"a && b || c && d", "((a && b) || (c && d))"},
+		{"a == 1 && !b", "((a == 1) && (!b))"},
+		{"x = a || b", "(x = (a || b))"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d))"},
+		{"a + b % c", "(a + (b % c))"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2))"},
+		{"-2 ** 2", "(-(2 ** 2))"},
+		{"2 ** -1", "(2 ** (-1))"},
+		{"a * b ** c", "(a * (b ** c))"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)))"},
+		{"a & b << c + d", "(a & (b << (c + d)))"},
+		{"a | b == c", "((a | b) == c)"},
+		{"a < b | c", "(a < (b | c))"},
+		{"~a & b", "((~a) & b)"},
+		{"a && b | c", "(a && (b | c))"},
+		{`x = {"b": 1, "a": 2 * c, 1: d}`, "(x = {b:1, a:(2 * c), 1:d})"},
 	}
 
 	for _, tt := range tests {
@@ -692,19 +743,25 @@ func TestParsingHashLiteral(t *testing.T) {
 				if len(hashLiteral.Pairs) != 3 {
 					t.Errorf("Expected 3 pairs, received %d", len(hashLiteral.Pairs))
 				}
-				expected := map[string]int64{
-					"one":   1,
-					"two":   2,
-					"three": 3,
+				expected := []struct {
+					key   string
+					value int64
+				}{
+					{"one", 1},
+					{"two", 2},
+					{"three", 3},
 				}
-				for key, value := range hashLiteral.Pairs {
-					stringLiteral, ok := key.(*ast.StringLiteral)
+				for i, pair := range hashLiteral.Pairs {
+					stringLiteral, ok := pair.Key.(*ast.StringLiteral)
 					if !ok {
-						t.Errorf("Expected string literal key, received %T", key)
+						t.Errorf("Expected string literal key, received %T", pair.Key)
 						continue
 					}
-					expectedValue := expected[stringLiteral.String()]
-					testIntegerLiteral(t, value, expectedValue)
+					// Pairs keep the source order
+					if stringLiteral.String() != expected[i].key {
+						t.Errorf("Pair %d: expected key %s, received %s", i, expected[i].key, stringLiteral.String())
+					}
+					testIntegerLiteral(t, pair.Value, expected[i].value)
 				}
 			},
 		},
@@ -730,10 +787,10 @@ func TestParsingHashLiteral(t *testing.T) {
 						testInfixExpression(t, e, 15, "/", 5)
 					},
 				}
-				for key, value := range hashLiteral.Pairs {
-					stringLiteral, ok := key.(*ast.StringLiteral)
+				for _, pair := range hashLiteral.Pairs {
+					stringLiteral, ok := pair.Key.(*ast.StringLiteral)
 					if !ok {
-						t.Errorf("Expected string literal key, received %T", key)
+						t.Errorf("Expected string literal key, received %T", pair.Key)
 						continue
 					}
 					testFunc, ok := tests[stringLiteral.String()]
@@ -741,7 +798,7 @@ func TestParsingHashLiteral(t *testing.T) {
 						t.Errorf("No test function for key %q", stringLiteral.String())
 						continue
 					}
-					testFunc(value)
+					testFunc(pair.Value)
 				}
 			},
 		},
@@ -764,3 +821,348 @@ func TestParsingHashLiteral(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeSpans(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;", "1:1-1:10"},
+		{"a + b * c", "1:1-1:10"},
+		{"-a", "1:1-1:3"},
+		{"add(1,\n  2)", "1:1-2:5"},
+		{"fn(x) {\n  x\n}", "1:1-3:2"},
+		{"if (x) { 1 } else { 2 }", "1:1-1:24"},
+		{`{"a": 1}`, "1:1-1:9"},
+		{"arr[1]", "1:1-1:7"},
+		{"return [1, 2];", "1:1-1:14"},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("Expected program statements to be 1, received %d", len(program.Statements))
+		}
+		span := program.Statements[0].Span().String()
+		if span != testCase.expected {
+			t.Errorf("Input %q: expected span %s, received %s", testCase.input, testCase.expected, span)
+		}
+	}
+}
+
+func TestParserDiagnostics(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedCode     diagnostic.Code
+		expectedMessage  string
+		expectedPosition string
+		expectedFound    token.TokenType
+	}{
+		{"let = 5;", diagnostic.UNEXPECTED_TOKEN, "expected next token to be IDENT, got = instead", "1:5", token.ASSIGN},
+		{"let x 5;", diagnostic.UNEXPECTED_TOKEN, "expected next token to be =, got INT instead", "1:7", token.INT},
+		{"add(1, 2", diagnostic.UNEXPECTED_TOKEN, "expected next token to be ), got EOF instead", "1:9", token.EOF},
+		{"let x = ;", diagnostic.EXPECTED_EXPR, "expected an expression, got ; instead", "1:9", token.SEMICOLON},
+		{"5 + @", diagnostic.ILLEGAL_CHARACTER, `illegal character "@"`, "1:5", token.ILLEGAL},
+		{`let s = "abc`, diagnostic.UNTERMINATED_STR, "unterminated string literal", "1:9", ""},
+		{`let s = "a\qb";`, diagnostic.INVALID_ESCAPE, `unknown escape sequence \q`, "1:11", ""},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("Input %q: expected parser errors, received none", testCase.input)
+		}
+		d := errors[0]
+		if d.Severity != diagnostic.ERROR {
+			t.Errorf("Input %q: expected severity %s, received %s", testCase.input, diagnostic.ERROR, d.Severity)
+		}
+		if d.Code != testCase.expectedCode {
+			t.Errorf("Input %q: expected code %s, received %s", testCase.input, testCase.expectedCode, d.Code)
+		}
+		if d.Message != testCase.expectedMessage {
+			t.Errorf("Input %q: expected message %q, received %q", testCase.input, testCase.expectedMessage, d.Message)
+		}
+		if d.Span.Start.String() != testCase.expectedPosition {
+			t.Errorf("Input %q: expected position %s, received %s", testCase.input, testCase.expectedPosition, d.Span.Start)
+		}
+		if d.Found != testCase.expectedFound {
+			t.Errorf("Input %q: expected found token %s, received %s", testCase.input, testCase.expectedFound, d.Found)
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	testCases := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			input:              "let = 5; let y = 10; y",
+			expectedErrors:     []string{"1:5"},
+			expectedStatements: "let y = 10;y",
+		},
+		{
+			input:              "let x = 5 +; let y = (1; return y;",
+			expectedErrors:     []string{"1:12", "1:24"},
+			expectedStatements: "return y;",
+		},
+		{
+			input:              "let f = fn(x y) { x }; f(1)",
+			expectedErrors:     []string{"1:14"},
+			expectedStatements: "f(1)",
+		},
+		{
+			input:              "let f = fn(x) { let = 1; x + }; let z = 3;",
+			expectedErrors:     []string{"1:21", "1:30"},
+			expectedStatements: "let f = fn(x);let z = 3;",
+		},
+		{
+			input:              "if (x { 1 } let a = 1;",
+			expectedErrors:     []string{"1:7"},
+			expectedStatements: "let a = 1;",
+		},
+		{
+			input:              "if (return) { let = 1 }; let a = 1;",
+			expectedErrors:     []string{"1:5"},
+			expectedStatements: "let a = 1;",
+		},
+		{
+			input:              "} let a = 1;",
+			expectedErrors:     []string{"1:1"},
+			expectedStatements: "let a = 1;",
+		},
+		{
+			input:              "let a = 5 +\nlet b = ; b",
+			expectedErrors:     []string{"2:1", "2:9"},
+			expectedStatements: "b",
+		},
+		{
+			input:              "let a = [1, return 2; let c = 3;",
+			expectedErrors:     []string{"1:13"},
+			expectedStatements: "return 2;let c = 3;",
+		},
+	}
+
+	for _, testCase := range testCases {
+		l := lexer.New(testCase.input)
+		p := New(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(testCase.expectedErrors) {
+			t.Errorf("Input %q: expected %d errors, received %d: %v", testCase.input, len(testCase.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, expectedPosition := range testCase.expectedErrors {
+			if errors[i].Span.Start.String() != expectedPosition {
+				t.Errorf("Input %q: expected error %d at %s, received %v", testCase.input, i, expectedPosition, errors[i])
+			}
+		}
+		if program.String() != testCase.expectedStatements {
+			t.Errorf("Input %q: expected partial program %q, received %q", testCase.input, testCase.expectedStatements, program.String())
+		}
+	}
+}
+
+func TestAssignExpressionParsing(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"x = 5;", "(x = 5)"},
+		{"x += 1 + 2;", "(x += (1 + 2))"},
+		{"a = b = c;", "(a = (b = c))"},
+		{`h["k"] = 1;`, "((h[k]) = 1)"},
+		{"a[i + 1] += a[i];", "((a[(i + 1)]) += (a[i]))"},
+		{"x *= y == z;", "(x *= (y == z))"},
+		{"let f = fn() { count -= 1 };", "let f = fn()(count -= 1);"},
+	}
+	for _, testCase := range testCases {
+		p := New(lexer.New(testCase.input))
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+		if program.String() != testCase.expected {
+			t.Errorf("Expected %q, received %q", testCase.expected, program.String())
+		}
+	}
+}
+
+func TestLoopParsing(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x += 1 }", "while (x < 10) (x += 1)"},
+		{"while (true) { break; }", "while true break;"},
+		{"for (x in [1, 2]) { print(x); }", "for (x in [1, 2]) print(x)"},
+		{"for (c in s) { n += 1; continue; }", "for (c in s) (n += 1)continue;"},
+		{"while (a) { while (b) { break } }", "while a while b break;"},
+	}
+	for _, testCase := range testCases {
+		p := New(lexer.New(testCase.input))
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+		if program.String() != testCase.expected {
+			t.Errorf("Expected %q, received %q", testCase.expected, program.String())
+		}
+	}
+}
+
+func TestBreakOutsideLoop(t *testing.T) {
+	testCases := []struct {
+		input            string
+		expectedMessage  string
+		expectedPosition string
+	}{
+		{"break;", "break outside of a loop", "1:1"},
+		{"let x = 1; continue", "continue outside of a loop", "1:12"},
+		{"while (true) { let f = fn() { break; }; }", "break outside of a loop", "1:31"},
+	}
+	for _, testCase := range testCases {
+		p := New(lexer.New(testCase.input))
+		p.ParseProgram()
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("Input %q: expected 1 error, received %v", testCase.input, errors)
+		}
+		if errors[0].Code != diagnostic.OUTSIDE_LOOP || errors[0].Message != testCase.expectedMessage {
+			t.Errorf("Input %q: expected %q, received %s", testCase.input, testCase.expectedMessage, errors[0])
+		}
+		if errors[0].Span.Start.String() != testCase.expectedPosition {
+			t.Errorf("Input %q: expected position %s, received %s", testCase.input, testCase.expectedPosition, errors[0].Span.Start)
+		}
+	}
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	p := New(lexer.New("1 + x = 2;"))
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("Expected 1 error, received %v", errors)
+	}
+	if errors[0].Code != diagnostic.INVALID_ASSIGN || errors[0].Message != "cannot assign to (1 + x)" {
+		t.Errorf("Expected invalid assignment error, received %s", errors[0])
+	}
+	if errors[0].Span.String() != "1:1-1:6" {
+		t.Errorf("Expected span 1:1-1:6, received %s", errors[0].Span)
+	}
+}
+
+func TestCommentsAreKeptOnTokens(t *testing.T) {
+	input := `// Adds two numbers
+let add = fn(a, b) { a /* left */ + b };`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("Expected program statements to be 1, received %d", len(program.Statements))
+	}
+	letStatement, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("Expected *ast.LetStatement, received %T", program.Statements[0])
+	}
+	if len(letStatement.Token.Comments) != 1 || letStatement.Token.Comments[0].Text != "// Adds two numbers" {
+		t.Errorf("Expected the doc comment on the let token, received %v", letStatement.Token.Comments)
+	}
+	if program.String() != "let add = fn(a, b)(a + b);" {
+		t.Errorf("Expected comments to be ignored by the parser, received %q", program.String())
+	}
+}
+
+func TestTrailingComments(t *testing.T) {
+	input := `let a = 1; // one
+/* the end */`
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParseErrors(t, p)
+
+	texts := []string{}
+	for _, comment := range program.TrailingComments {
+		texts = append(texts, comment.Text)
+	}
+	if strings.Join(texts, "|") != "// one|/* the end */" {
+		t.Errorf("Expected the trailing comments on the program, received %q", texts)
+	}
+}
+
+func TestCommentsOnSkippedTokensMoveToTheNextToken(t *testing.T) {
+	testCases := []struct {
+		input    string
+		comment  string
+		expected func(program *ast.Program) token.Token
+	}{
+		{
+			input:   "let a /* name */ = /* value */ 1;",
+			comment: "/* value */",
+			expected: func(program *ast.Program) token.Token {
+				return program.Statements[0].(*ast.LetStatement).Value.(*ast.IntegerLiteral).Token
+			},
+		},
+		{
+			input:   "let a = 1 /* end */; a",
+			comment: "/* end */",
+			expected: func(program *ast.Program) token.Token {
+				return program.Statements[1].(*ast.ExpressionStatement).Token
+			},
+		},
+		{
+			input:   "[1 /* first */, 2]",
+			comment: "/* first */",
+			expected: func(program *ast.Program) token.Token {
+				array := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral)
+				return array.Elements[1].(*ast.IntegerLiteral).Token
+			},
+		},
+		{
+			input:   `{"a" /* key */: 1}`,
+			comment: "/* key */",
+			expected: func(program *ast.Program) token.Token {
+				hash := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.HashLiteral)
+				return hash.Pairs[0].Value.(*ast.IntegerLiteral).Token
+			},
+		},
+		{
+			input:   "if (x /* condition */) { 1 }",
+			comment: "/* condition */",
+			expected: func(program *ast.Program) token.Token {
+				return program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression).Consequence.Token
+			},
+		},
+		{
+			input:   "/* inner */ (1 + 2) * 3",
+			comment: "/* inner */",
+			expected: func(program *ast.Program) token.Token {
+				product := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+				return product.Left.(*ast.InfixExpression).Left.(*ast.IntegerLiteral).Token
+			},
+		},
+		{
+			input:   "1 + 2;\n/* last */",
+			comment: "/* last */",
+			expected: func(program *ast.Program) token.Token {
+				return token.Token{Comments: program.TrailingComments}
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		p := New(lexer.New(testCase.input))
+		program := p.ParseProgram()
+		checkParseErrors(t, p)
+
+		comments := testCase.expected(program).Comments
+		if len(comments) == 0 || comments[len(comments)-1].Text != testCase.comment {
+			t.Errorf("Input %q: expected %s on the next token, received %v", testCase.input, testCase.comment, comments)
+		}
+	}
+}
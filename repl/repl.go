@@ -5,14 +5,23 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/diagnostic"
 	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
 	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
 	"github.com/zawlinnnaing/monkey-language-in-golang/object"
 	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
+	"github.com/zawlinnnaing/monkey-language-in-golang/vm"
 )
 
 const PROMPT = ">>"
 
+// Engines executing the programs
+const (
+	ENGINE_EVAL = "eval"
+	ENGINE_VM   = "vm"
+)
+
 const MONKEY_FACE = `                                                                
                             ▓▓▓▓▓▓▓▓▓▓                          
                           ▓▓▓▓▓▓▓▓▓▓▓▓▓▓                        
@@ -31,18 +40,20 @@ const MONKEY_FACE = `
                           ▓▓▓▓░░▓▓░░▓▓▓▓                                                                            
 `
 
-func printParserErrors(out io.Writer, errors []string) {
+func printParserErrors(out io.Writer, source string, errors []diagnostic.Diagnostic) {
 	io.WriteString(out, MONKEY_FACE)
 	io.WriteString(out, "🐒 Whoops!, we ran into some error 🙈.\n")
 	io.WriteString(out, "Parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
-	}
+	diagnostic.RenderAll(out, source, errors)
 }
 
-func Start(in io.Reader, out io.Writer) {
+// Start reads lines from in and executes them with the given engine, ENGINE_EVAL or ENGINE_VM
+func Start(in io.Reader, out io.Writer, engine string) {
 	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	execute := newEvalExecutor()
+	if engine == ENGINE_VM {
+		execute = newVMExecutor()
+	}
 
 	for {
 		fmt.Fprint(out, PROMPT)
@@ -58,15 +69,32 @@ func Start(in io.Reader, out io.Writer) {
 		program := parser.ParseProgram()
 
 		if len(parser.Errors()) > 0 {
-			printParserErrors(out, parser.Errors())
+			printParserErrors(out, line, parser.Errors())
 			// Stop further evaluation if there are parser errors
 			continue
 		}
-		evaluated := evaluator.Eval(program, env)
+		evaluated := execute(program)
 
-		if evaluated != nil {
+		if errObj, ok := evaluated.(*object.Error); ok {
+			io.WriteString(out, errObj.StackTrace())
+			io.WriteString(out, "\n")
+		} else if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
 		}
 	}
 }
+
+// executor runs a line, the bindings of the previous lines are kept
+type executor func(program *ast.Program) object.Object
+
+func newEvalExecutor() executor {
+	env := object.NewEnvironment()
+	return func(program *ast.Program) object.Object {
+		return evaluator.Eval(program, env)
+	}
+}
+
+func newVMExecutor() executor {
+	return vm.NewSession().Run
+}
@@ -1,10 +1,73 @@
 package token
 
+import "fmt"
+
 type TokenType string
 
+// Position describes a location in the source. Lines and columns start at 1,
+// the byte offset starts at 0. Columns count code points, not bytes.
+type Position struct {
+	Filename string `json:"filename,omitempty"`
+	Offset   int    `json:"offset"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+}
+
+// IsValid reports whether the position was produced by the lexer.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	out := p.Filename
+	if p.IsValid() {
+		if out != "" {
+			out += ":"
+		}
+		out += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if out == "" {
+		out = "-"
+	}
+	return out
+}
+
+// Span is the source range [Start, End) covered by a token or a node.
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+func (s Span) String() string {
+	return fmt.Sprintf("%s-%d:%d", s.Start, s.End.Line, s.End.Column)
+}
+
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Position of the first character of the token
+	Pos Position
+	// Position immediately after the last character of the token
+	End Position
+	// Comments between the previous token and this one, comments at the end
+	// of the input belong to the EOF token
+	Comments []Comment
+}
+
+func (t Token) Span() Span {
+	return Span{Start: t.Pos, End: t.End}
+}
+
+// Comment is a `// ...` line comment or a `/* ... */` block comment, Text
+// includes the delimiters
+type Comment struct {
+	Text string
+	Pos  Position
+	End  Position
+}
+
+func (c Comment) Span() Span {
+	return Span{Start: c.Pos, End: c.End}
 }
 
 const (
@@ -14,8 +77,13 @@ const (
 	// User identified token
 	IDENT = "IDENT"
 	INT   = "INT"
+	FLOAT = "FLOAT"
 
-	ASSIGN = "="
+	ASSIGN          = "="
+	PLUS_ASSIGN     = "+="
+	MINUS_ASSIGN    = "-="
+	ASTERISK_ASSIGN = "*="
+	SLASH_ASSIGN    = "/="
 	// TODO: add support for all operators (+,-,*,/)
 	PLUS = "+"
 
@@ -36,28 +104,52 @@ const (
 	MINUS    = "-"
 	SLASH    = "/"
 	ASTERISK = "*"
+	PERCENT  = "%"
+	POWER    = "**"
 	LT       = "<"
 	GT       = ">"
+	LT_EQ    = "<="
+	GT_EQ    = ">="
 	EQ       = "=="
 	NOT_EQ   = "!="
+	AND      = "&&"
+	OR       = "||"
+
+	// Bitwise operators
+	AMPERSAND   = "&"
+	PIPE        = "|"
+	CARET       = "^"
+	TILDE       = "~"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
 
-	IF     = "IF"
-	ELSE   = "ELSE"
-	RETURN = "RETURN"
-	TRUE   = "TRUE"
-	FALSE  = "FALSE"
+	IF       = "IF"
+	ELSE     = "ELSE"
+	RETURN   = "RETURN"
+	TRUE     = "TRUE"
+	FALSE    = "FALSE"
+	WHILE    = "WHILE"
+	FOR      = "FOR"
+	IN       = "IN"
+	BREAK    = "BREAK"
+	CONTINUE = "CONTINUE"
 
 	STRING = "STRING"
 )
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
-	"true":   TRUE,
-	"false":  FALSE,
+	"fn":       FUNCTION,
+	"let":      LET,
+	"if":       IF,
+	"else":     ELSE,
+	"return":   RETURN,
+	"true":     TRUE,
+	"false":    FALSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
 }
 
 var AVAILABLE_TOKEN_TYPES []TokenType = []TokenType{
@@ -0,0 +1,40 @@
+package vm
+
+import (
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+type Frame struct {
+	cl *object.Closure
+	// Offset of the instruction being executed
+	ip int
+	// Stack pointer before the call, locals are stored from there
+	basePointer int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
+
+// position returns the source position of the instruction being executed
+func (f *Frame) position() token.Position {
+	for offset := f.ip; offset >= 0; offset-- {
+		if position, ok := f.cl.Fn.Positions[offset]; ok {
+			return position
+		}
+	}
+	return token.Position{}
+}
+
+func (f *Frame) functionName() string {
+	if f.cl.Fn.Name != "" {
+		return f.cl.Fn.Name
+	}
+	return "<anonymous>"
+}
@@ -0,0 +1,19 @@
+package vm
+
+import "github.com/zawlinnnaing/monkey-language-in-golang/object"
+
+const ITERATOR_OBJ = "ITERATOR"
+
+// iterator holds the state of a for loop, it is stored in a binding the program can't name
+type iterator struct {
+	elements []object.Object
+	index    int
+}
+
+func (i *iterator) Type() object.ObjectType {
+	return ITERATOR_OBJ
+}
+
+func (i *iterator) Inspect() string {
+	return "iterator"
+}
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/compiler"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+)
+
+/*
+Session compiles and runs programs one after another, e.g. the lines of a
+REPL, each program sees the globals of the earlier ones. Compile and runtime
+errors are returned as *object.Error like in the evaluator.
+*/
+type Session struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+}
+
+func NewSession() *Session {
+	return &Session{
+		symbolTable: compiler.NewGlobalSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, GLOBALS_SIZE),
+	}
+}
+
+// Define binds a global, e.g. the arguments of a script
+func (s *Session) Define(name string, value object.Object) {
+	symbol := s.symbolTable.Define(name)
+	s.globals[symbol.Index] = value
+}
+
+// Run returns the value of the last expression statement of program
+func (s *Session) Run(program *ast.Program) object.Object {
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	if err := comp.Compile(program); err != nil {
+		if compileErr, ok := err.(*compiler.CompileError); ok {
+			return &object.Error{Message: compileErr.Message, Pos: compileErr.Pos}
+		}
+		return &object.Error{Message: err.Error()}
+	}
+	bytecode := comp.Bytecode()
+	s.constants = bytecode.Constants
+
+	machine := NewWithGlobalsState(bytecode, s.globals)
+	if err := machine.Run(); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
+		}
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
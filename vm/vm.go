@@ -0,0 +1,537 @@
+package vm
+
+import (
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/compiler"
+	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+)
+
+const (
+	STACK_SIZE   = 2048
+	GLOBALS_SIZE = 65536
+	MAX_FRAMES   = 1024
+)
+
+// Values are shared with the evaluator, so builtins and operations return the same objects
+var (
+	TRUE  = evaluator.TRUE
+	FALSE = evaluator.FALSE
+	NULL  = evaluator.NULL
+)
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+}
+
+var prefixOperators = map[code.Opcode]string{
+	code.OpBang:   "!",
+	code.OpMinus:  "-",
+	code.OpBitNot: "~",
+}
+
+type openCell struct {
+	slot int
+	cell *object.Cell
+}
+
+type VM struct {
+	constants []object.Object
+	globals   []object.Object
+
+	stack []object.Object
+	// Always points to the next free slot, the top of the stack is stack[sp-1]
+	sp int
+
+	frames      []*Frame
+	framesIndex int
+
+	// Cells referring to stack slots of running functions, ordered by slot
+	openCells []openCell
+	// Cells pushed by the capture instructions for the next OpClosure
+	captures []*object.Cell
+
+	builtins     []*object.BuiltIn
+	builtinNames []string
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobalsState(bytecode, make([]object.Object, GLOBALS_SIZE))
+}
+
+// NewWithGlobalsState creates a vm that keeps the globals of earlier runs, e.g. between REPL lines
+func NewWithGlobalsState(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	frames := make([]*Frame, MAX_FRAMES)
+	frames[0] = NewFrame(mainClosure, 0)
+
+	builtinNames := evaluator.BuiltinNames()
+	builtins := make([]*object.BuiltIn, len(builtinNames))
+	for i, name := range builtinNames {
+		builtins[i], _ = evaluator.LookupBuiltin(name)
+	}
+
+	return &VM{
+		constants:    bytecode.Constants,
+		globals:      globals,
+		stack:        make([]object.Object, STACK_SIZE),
+		frames:       frames,
+		framesIndex:  1,
+		builtins:     builtins,
+		builtinNames: builtinNames,
+	}
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+/*
+Run executes the bytecode. Runtime errors are returned as *object.Error with
+the position and the stack trace filled in, like in the evaluator.
+*/
+func (vm *VM) Run() (err error) {
+	// Like the evaluator, panics become runtime errors at the current instruction
+	defer func() {
+		if r := recover(); r != nil {
+			err = vm.runtimeError(object.NewError("internal error: %v", r), 0)
+		}
+	}()
+	return vm.execute(0)
+}
+
+// execute runs instructions until the frames above baseFrames have returned, or the program ends
+func (vm *VM) execute(baseFrames int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.framesIndex > baseFrames && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod, code.OpPow,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpGreaterEqual, code.OpLessEqual:
+			right := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.InfixOperation(infixOperators[op], left, right))
+
+		case code.OpBang, code.OpMinus, code.OpBitNot:
+			right := vm.pop()
+			err = vm.pushResult(evaluator.PrefixOperation(prefixOperators[op], right))
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+		case code.OpFalse:
+			err = vm.push(FALSE)
+		case code.OpNull:
+			err = vm.push(NULL)
+
+		case code.OpJump:
+			position := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = position - 1
+
+		case code.OpJumpNotTruthy:
+			position := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			condition := vm.pop()
+			if !evaluator.IsTruthy(condition) {
+				vm.currentFrame().ip = position - 1
+			}
+
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			position := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			if evaluator.IsTruthy(vm.stack[vm.sp-1]) == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().ip = position - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpIter:
+			elements, iterErr := evaluator.Iterate(vm.pop())
+			if iterErr != nil {
+				err = iterErr
+				break
+			}
+			err = vm.push(&iterator{elements: elements})
+
+		case code.OpIterNext:
+			position := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			iter := vm.pop().(*iterator)
+			if iter.index < len(iter.elements) {
+				err = vm.push(iter.elements[iter.index])
+				iter.index++
+			} else {
+				vm.currentFrame().ip = position - 1
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+			global := vm.globals[globalIndex]
+			if global == nil {
+				// Bound by a line of the REPL that failed to compile
+				global = NULL
+			}
+			err = vm.push(global)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			frame := vm.currentFrame()
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(vm.builtins[builtinIndex])
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex].Get())
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.currentFrame().cl.Free[freeIndex].Set(vm.pop())
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.captures = append(vm.captures, vm.captureSlot(vm.currentFrame().basePointer+int(localIndex)))
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			vm.captures = append(vm.captures, vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpCaptureValue:
+			vm.captures = append(vm.captures, object.NewClosedCell(vm.pop()))
+
+		case code.OpCurrentClosure:
+			err = vm.push(vm.currentFrame().cl)
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+			err = vm.push(array)
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+			hash := vm.buildHash(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+			err = vm.pushResult(hash)
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+			err = vm.pushResult(evaluator.IndexOperation(left, index))
+
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			container := vm.pop()
+			err = vm.pushResult(evaluator.IndexAssignOperation(container, index, value))
+
+		case code.OpDupPair:
+			err = vm.push(vm.stack[vm.sp-2])
+			if err == nil {
+				err = vm.push(vm.stack[vm.sp-2])
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// Returning from the top level ends the program, the value
+				// stays in the last popped slot
+				return nil
+			}
+			frame := vm.popFrame()
+			vm.closeCells(frame.basePointer)
+			vm.sp = frame.basePointer - 1
+			err = vm.push(returnValue)
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.closeCells(frame.basePointer)
+			vm.sp = frame.basePointer - 1
+			err = vm.push(NULL)
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		default:
+			err = object.NewError("unknown opcode: %d", op)
+		}
+
+		if err != nil {
+			return vm.runtimeError(err, baseFrames)
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+func (vm *VM) push(obj object.Object) error {
+	if vm.sp >= STACK_SIZE {
+		return object.NewError("stack overflow")
+	}
+	vm.stack[vm.sp] = obj
+	vm.sp++
+	return nil
+}
+
+// pushResult pushes the result of an operation, error objects abort the execution
+func (vm *VM) pushResult(obj object.Object) error {
+	if errObj, ok := obj.(*object.Error); ok {
+		return errObj
+	}
+	return vm.push(obj)
+}
+
+func (vm *VM) pop() object.Object {
+	obj := vm.stack[vm.sp-1]
+	vm.sp--
+	return obj
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+	copy(elements, vm.stack[startIndex:endIndex])
+	return &object.Array{Elements: elements}
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) object.Object {
+	hash := object.NewHash()
+	for i := startIndex; i < endIndex; i += 2 {
+		if errObj := hash.Set(vm.stack[i], vm.stack[i+1]); errObj != nil {
+			return errObj
+		}
+	}
+	return hash
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.BuiltIn:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return object.NewError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return object.NewError("arguments mismatch. Defined %d, received: %d", cl.Fn.NumParameters, numArgs)
+	}
+	if vm.framesIndex >= MAX_FRAMES {
+		return object.NewError("stack overflow")
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+cl.Fn.NumLocals >= STACK_SIZE {
+		return object.NewError("stack overflow")
+	}
+	vm.pushFrame(frame)
+	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.BuiltIn, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+	result := builtin.Call(&caller{vm: vm}, args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if errObj, ok := result.(*object.Error); ok {
+		position := vm.currentFrame().position()
+		if !errObj.Pos.IsValid() {
+			errObj.Pos = position
+		}
+		errObj.Stack = append(errObj.Stack, object.Frame{Function: vm.builtinName(builtin), CallSite: position})
+		return errObj
+	}
+	if result == nil {
+		result = NULL
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) builtinName(builtin *object.BuiltIn) string {
+	for i, b := range vm.builtins {
+		if b == builtin {
+			return vm.builtinNames[i]
+		}
+	}
+	return "<builtin>"
+}
+
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return object.NewError("not a function: %s", constant.Type())
+	}
+
+	free := make([]*object.Cell, numFree)
+	copy(free, vm.captures[len(vm.captures)-numFree:])
+	vm.captures = vm.captures[:len(vm.captures)-numFree]
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// captureSlot returns the cell of a stack slot, closures capturing the same
+// variable share its cell
+func (vm *VM) captureSlot(slot int) *object.Cell {
+	for i := len(vm.openCells) - 1; i >= 0 && vm.openCells[i].slot >= slot; i-- {
+		if vm.openCells[i].slot == slot {
+			return vm.openCells[i].cell
+		}
+	}
+	cell := object.NewCell(&vm.stack[slot])
+	// Captured slots only grow within a frame, but keep the order in any case
+	index := len(vm.openCells)
+	for index > 0 && vm.openCells[index-1].slot > slot {
+		index--
+	}
+	vm.openCells = append(vm.openCells, openCell{})
+	copy(vm.openCells[index+1:], vm.openCells[index:])
+	vm.openCells[index] = openCell{slot: slot, cell: cell}
+	return cell
+}
+
+// closeCells closes the cells of the slots of a returning frame
+func (vm *VM) closeCells(basePointer int) {
+	for len(vm.openCells) > 0 && vm.openCells[len(vm.openCells)-1].slot >= basePointer {
+		vm.openCells[len(vm.openCells)-1].cell.Close()
+		vm.openCells = vm.openCells[:len(vm.openCells)-1]
+	}
+}
+
+// runtimeError fills in the position and the stack trace of the frames above baseFrames the error propagates through
+func (vm *VM) runtimeError(err error, baseFrames int) error {
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+	if !errObj.Pos.IsValid() {
+		errObj.Pos = vm.currentFrame().position()
+	}
+	for i := vm.framesIndex - 1; i > 0 && i >= baseFrames; i-- {
+		errObj.Stack = append(errObj.Stack, object.Frame{
+			Function: vm.frames[i].functionName(),
+			CallSite: vm.frames[i-1].position(),
+		})
+	}
+	return errObj
+}
+
+// caller lets builtins call functions on the stack of the vm running them
+type caller struct {
+	vm *VM
+}
+
+func (c *caller) Call(function object.Object, args ...object.Object) object.Object {
+	vm := c.vm
+	sp, framesIndex := vm.sp, vm.framesIndex
+	err := vm.push(function)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil && vm.framesIndex > framesIndex {
+		err = vm.execute(framesIndex)
+	}
+	if err != nil {
+		// Unwind the frames of the call, the frames below are reported by the caller of the builtin
+		vm.closeCells(sp)
+		vm.sp, vm.framesIndex = sp, framesIndex
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
+		}
+		return object.NewError("%s", err)
+	}
+	result := vm.pop()
+	vm.sp = sp
+	return result
+}
@@ -0,0 +1,428 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zawlinnnaing/monkey-language-in-golang/ast"
+	"github.com/zawlinnnaing/monkey-language-in-golang/code"
+	"github.com/zawlinnnaing/monkey-language-in-golang/compiler"
+	"github.com/zawlinnnaing/monkey-language-in-golang/evaluator"
+	"github.com/zawlinnnaing/monkey-language-in-golang/lexer"
+	"github.com/zawlinnnaing/monkey-language-in-golang/object"
+	"github.com/zawlinnnaing/monkey-language-in-golang/parser"
+	"github.com/zawlinnnaing/monkey-language-in-golang/token"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("Input %q has parser errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+// testRun compiles and runs the input, errors are returned as *object.Error like in the evaluator
+func testRun(t *testing.T, input string) object.Object {
+	comp := compiler.New()
+	if err := comp.Compile(parse(t, input)); err != nil {
+		if compileErr, ok := err.(*compiler.CompileError); ok {
+			return &object.Error{Message: compileErr.Message, Pos: compileErr.Pos}
+		}
+		t.Fatalf("Input %q: compiler error: %s", input, err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("Input %q: vm error: %s", input, err)
+		}
+		return errObj
+	}
+	return machine.LastPoppedStackElem()
+}
+
+func testInspect(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+	if errObj, ok := obj.(*object.Error); ok {
+		return "ERROR: " + errObj.Message
+	}
+	return obj.Inspect()
+}
+
+// Inputs of evaluator_test.go, the vm must produce the same results as the evaluator
+var engineTestInputs = []string{
+	"5", "10", "-5", "-10",
+	"5 + 5 + 5 + 5 - 10",
+	"2 * 2 * 2 * 2 * 2",
+	"-50 + 100 + -50",
+	"5 * 2 + 10",
+	"5 + 2 * 10",
+	"20 + 2 * -10",
+	"50 / 2 * 2 + 10",
+	"2 * (5 + 10)",
+	"3 * 3 * 3 + 10",
+	"3 * (3 * 3) + 10",
+	"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+	`"Hello World!"`,
+	`"hello" + " " + "world"`,
+	"true", "false",
+	"1 < 2", "1 > 2", "1 < 1", "1 > 1",
+	"1 == 1", "1 != 1", "1 == 2", "1 != 2",
+	"true == true", "false == false", "true == false", "true != false", "false != true",
+	"(1 < 2) == true", "(1 < 2) == false", "(1 > 2) == true", "(1 > 2) == false",
+	"!true", "!false", "!!true", "!!false", "!5", "!0", "!!5", "!!0", "!-5", "!-0",
+	"if (true) { 10 }",
+	"if (false) { 10 }",
+	"if (1) { 10 }",
+	"if (1 < 2) { 10 }",
+	"if (1 > 2) { 10 }",
+	"if (1 > 2) { 10 } else { 20 }",
+	"if (1 < 2) { 10 } else { 20 }",
+	"return 10;",
+	"return 10; 9;",
+	"return 2 * 5; 9;",
+	"9; return 2 * 5; 9;",
+	`if (10 > 1) { if (10 > 1) { return 10; } return 1; }`,
+	"let f = fn() { return 5; }; f();",
+	"let f = fn() { return 5; 10; }; f();",
+	"let f = fn() { 5; return 10; }; f();",
+	"5 + true;",
+	"5 + true; 5;",
+	"-true",
+	"true + false;",
+	"5; true + false; 5",
+	"if (10 > 1) { true + false; }",
+	`if (10 > 1) {
+	  if (10 > 1) {
+	    return true + false;
+	  }
+	  return 1;
+	}`,
+	"a",
+	"let f = fn(x, y) { x + y; }; f();",
+	"let f = fn(x) { x; }; f(1, 2, 3);",
+	`"hello" - "world"`,
+	`[1, 2, 3]["foo"]`,
+	`{"name": "Monkey"}[fn(x) { x }];`,
+	"let a = 5; a;",
+	"let a = 5 * 5; a;",
+	"let a = 5; let b = a; b;",
+	"let a = 5; let b = a; let c = a + b + 5; c;",
+	"let a = 5;",
+	"let identity = fn(x) { x; }; identity(5);",
+	"let identity = fn(x) { return x; }; identity(5);",
+	"let double = fn(x) { x * 2; }; double(5);",
+	"let add = fn(x, y) { x + y; }; add(5, 5);",
+	"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+	"fn(x) { x; }(5)",
+	`let newAdder = fn(x) {
+	  return fn(y) {x + y}
+	}
+	let addTwo = newAdder(2);
+	addTwo(2);`,
+	`let add = fn(x, y) { x + y };
+	let applyFunc = fn(f, a, b) { f(a, b) };
+	applyFunc(add, 2, 2);`,
+	`len("")`, `len("four")`, `len("hello world")`,
+	`len(1)`, `len("one", "two")`,
+	`len([1, 2, 3])`, `len([])`, `len([1, 2, 3, 4, 5])`,
+	`first([1, 2, 3])`, `first([])`, `first(1)`, `first(1, 2)`,
+	`last([1, 2, 3])`, `last([])`, `last(1)`, `last(1, 2)`,
+	`rest([1, 2, 3])`, `rest([1])`, `rest([])`, `rest(1)`, `rest(1, 2)`,
+	`let a = [1, 2, 3]; rest(rest(a))`,
+	`let a = [1, 2, 3]; rest(rest(rest(a)))`,
+	`push([], 1)`, `push([1], 2)`, `push([1, 2], 3)`,
+	`let a = [1]; push(a, 2); a`,
+	`push(1, 1)`, `push([1])`, `push([1], 2, 3)`,
+	"[1, 2, 3]",
+	"[1 + 2, 3 * 4, 5 + 6]",
+	"[]",
+	"[1, 2, 3][0]", "[1, 2, 3][1]", "[1, 2, 3][2]",
+	"let i = 0; [1][i];",
+	"[1, 2, 3][1 + 1];",
+	"let myArray = [1, 2, 3]; myArray[2];",
+	"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+	"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+	"[1, 2, 3][3]",
+	"[1, 2, 3][-1]",
+	`let two = "two"; {"one": 10 - 9, two: 1 + 1, "thr" + "ee": 6 / 2, 4: 4, true: 5, false: 6}["three"]`,
+	`{"foo": 5}["foo"]`,
+	`{"foo": 5}["bar"]`,
+	`let key = "foo"; {"foo": 5}[key]`,
+	`{}["foo"]`,
+	`{5: 5}[5]`,
+	`{true: 5}[true]`,
+	`{false: 5}[false]`,
+	"1.5 + 1", "10 / 4.0", "-2.5", "1 == 1.0", "2.5 < 3", "!0.0",
+	`{1: 5}[1.0]`,
+	`int(2.9)`, `float("1e-3")`, `str(2.0)`, `int("x")`,
+	`len("မြန်မာ")`, `"héllo"[1]`, `"abc"[3]`, `chars("aé")`,
+	"let a = 1; a = 2; a;",
+	"let a = 1; let b = 2; a = b = 3; a + b;",
+	"let a = 10; a += 5; a -= 3; a *= 2; a /= 4; a",
+	"let counter = fn() { let count = 0; fn() { count += 1 } }; let next = counter(); next(); next(); next();",
+	"let total = 0; let add = fn(x) { total = total + x }; add(2); add(3); total;",
+	"let a = 1; let f = fn() { let a = 2; a = 3; }; f(); a",
+	"x = 1",
+	"let a = 1; a += true",
+	`let pair = fn() {
+	  let n = 0;
+	  let inc = fn() { n += 1 };
+	  let get = fn() { n };
+	  [inc, get]
+	};
+	let p = pair();
+	p[0](); p[0]();
+	p[1]()`,
+	`let outer = fn() {
+	  let n = 0;
+	  let middle = fn() { fn() { n += 10 } };
+	  middle()();
+	  n
+	};
+	outer()`,
+	"let f = fn() { f = 5; 1 }; f(); f",
+	"let a = [1, 2, 3]; a[0] = 10; a",
+	"let a = [1, 2, 3]; a[1] += 5; a[1];",
+	"let a = [1, 2, 3]; let b = a; b[0] = 9; a[0];",
+	"let a = [[1], [2]]; a[1][0] = 5; a;",
+	`let h = {"n": 1}; h["n"] *= 4; h["n"];`,
+	`let h = {}; let set = fn(k, v) { h[k] = v }; set(1, 2); h[1];`,
+	"let a = [1, 2, 3]; a[3] = 4;",
+	"let a = [1]; a[5] += 1;",
+	`let s = "abc"; s[0] = "x";`,
+	"let i = 0; let next = fn() { i += 1; i - 1 }; let a = [0, 0]; a[next()] += 5; [a, i]",
+	"let i = 0; while (i < 10) { i += 1 }; i",
+	"while (false) { 1 }",
+	"let i = 0; while (true) { i += 1; if (i == 5) { break; } }; i",
+	"let i = 0; let odd = 0; while (i < 10) { i += 1; if (i / 2 * 2 == i) { continue; } odd += 1; }; odd",
+	"let sum = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } sum += x }; [sum, x]",
+	"let n = 0; for (k in {1: 2, 3: 4}) { n += k }; n",
+	`let s = ""; for (c in "héllo") { s = c + s }; s`,
+	"let a = [1, 2]; for (x in a) { a = push(a, x) }; a",
+	"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10; } } }; f()",
+	"let f = fn(xs) { let sum = 0; for (x in xs) { sum += x }; sum }; f([4, 5, 6])",
+	"let f = fn() { while (true) { break; } }; f()",
+	"let n = 0; for (x in [1, 2]) { for (y in [1, 2, 3]) { if (y == 2) { break; } n += 1 } }; n",
+	"let n = 0; while (n < 3) { let f = fn() { n += 1 }; f() }; n",
+	`let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; [fs[0](), fs[1]()]`,
+	"let f = fn() { let fs = []; for (x in [1, 2]) { fs = push(fs, fn() { x }) }; fs }; let fs = f(); [fs[0](), fs[1]()]",
+	"for (x in 5) { x }",
+	"let i = 0; while (i < 3) { i += 1; if (i == 2) { 1 + true } }",
+	"true && false", "false || true", "1 && 2", `"" || "default"`,
+	"1 == true || 7", "false && 1 + true", "true || 1 + true", "true && 1 + true",
+	"let n = 0; let inc = fn() { n += 1; true }; false && inc(); true || inc(); n",
+	"let i = 0; while (i < 10 && i != 4) { i += 1 }; i",
+	"7 % 3", "-7 % 3", "7.5 % 2", "2 ** 3 ** 2", "-2 ** 2", "2 ** -1", "2.5 ** 2",
+	"6 & 3", "6 | 3", "6 ^ 3", "~5", "1 << 4", "-16 >> 2", "1 << -1", "1 << 64", "1 << 63", "-1 >> 63", "1.5 & 1", "~1.5",
+	"1 <= 1", "2 >= 3", "1.5 <= 2",
+	`"a" == "a"`, `"abc" < "abd"`, `"b" >= "abc"`, `"a" - "b"`,
+	"1 / 0", "let x = 0; 10 % x", "9223372036854775807 + 1", "2 ** 63", "(-2) ** 63",
+	"(-9223372036854775807 - 1) / -1", "-(-9223372036854775807 - 1)", "push()",
+	"map([1, 2, 3], fn(x) { x * 2 })", "map([], fn(x) { x })", `map(["a", "bc"], len)`,
+	"filter([1, 2, 3, 4], fn(x) { x % 2 == 0 })",
+	"reduce([1, 2, 3], fn(acc, x) { acc + x })", "reduce([1, 2], fn(acc, x) { acc + x }, 10)", "reduce([], fn(a, b) { a })",
+	"let n = 0; each([1, 2, 3], fn(x) { n += x }); n",
+	"find([1, 2, 3], fn(x) { x > 1 })", "find([1], fn(x) { false })",
+	"any([1, 2], fn(x) { x > 1 })", "all([1, 2], fn(x) { x > 1 })", "all([], fn(x) { false })",
+	"zip([1, 2, 3], [4, 5])", `zip([1], ["a"], [true])`, "zip([1], 2)",
+	"flat_map([1, 2], fn(x) { [x, x * 10] })", "flat_map([1], fn(x) { x })",
+	`sort_by(["ccc", "a", "bb", "d"], len)`, "sort_by([3, 1, 2], fn(x) { -x })", `sort_by([1, "a"], fn(x) { x })`,
+	"group_by([1, 2, 3, 4, 5], fn(x) { x % 2 == 0 })[false]",
+	"map([1, 2], fn(x) { x + true })", "map([1], fn(a, b) { a })", "map(1, fn(x) { x })", "map([1], 2)",
+	"let total = fn(xs) { reduce(map(xs, fn(x) { x * x }), fn(a, b) { a + b }, 0) }; total([1, 2, 3])",
+	"let f = fn(x) { map([x], fn(y) { map([y], fn(z) { z + x }) }) }; f(1)",
+	`let h = {}; h["b"] = 1; h["a"] = 2; [keys(h), values(h), entries(h), len(h)]`,
+	`let h = {"a": 1}; [has(h, "a"), delete(h, "a"), h, merge(h, {"b": 2})]`,
+	`let h = {}; h[2] = 1; h[1] = 2; let s = 0; for (k in h) { s = s * 10 + k }; s`,
+	"keys(1)", "has({}, [])",
+	`{"b": 1, "a": 2, 3: 3, true: 4}`, `{"a": 1, "b": 2, "a": 3}`,
+	`let log = []; let f = fn(x) { log = push(log, x); x }; {f("k1"): f(1), f("k2"): f(2)}; log`,
+	"[1, 2] == [1, 2]", "[1, [2]] != [1, [2.0]]", `{"a": 1, "b": 2} == {"b": 2, "a": 1}`,
+	"let f = fn() { 1 }; [f == f, fn() { 1 } == fn() { 1 }, len == len]",
+	`1 == "1"`, `"a" != 2`, "[] == {}",
+	"[9007199254740993 == 9007199254740992.0, [9007199254740993] == [9007199254740992.0], {9007199254740992.0: 1}[9007199254740993]]",
+	"[9007199254740993 > 9007199254740992.0, 1 < 1.5, 2 >= 2.0]",
+	"let nothing = fn() {}; [nothing(), nothing() == nothing(), if (true) {} == 1]",
+	"let x = 0; while (x < 3) { let y = if (x == 1) { break; } else { 5 }; x += 1 }; x",
+	"let r = []; for (i in [1, 2, 3]) { r = push(r, if (i == 2) { continue; } else { i }) }; r",
+	"let n = 0; while (true) { n += 1; 1 + if (true) { break; } }; n",
+	"let n = 0; for (i in [1, 2, 3]) { n += if (i == 2) { continue; } else { i } }; n",
+	"let r = []; for (i in [1, 2]) { r = [r, if (i == 2) { break; } else { i }] }; r",
+	"let f = fn(x) { let y = if (x > 0) { return x * 2; } else { 0 }; y - 1 }; [f(3), f(0)]",
+	"let n = 0; while (n < 5) { n += 1; -if (n == 3) { break; } else { 1 } }; n",
+	// Operands pushed before break or continue are popped, so the stack doesn't grow with each iteration
+	"let i = 0; while (i < 5000) { i += 1; let y = 1 + if (true) { continue; } else { 2 }; }; i",
+	"let i = 0; while (i < 5000) { i += 1; len(1, if (true) { continue; }) }; i",
+	"let i = 0; while (i < 5000) { i += 1; [1, 2, {\"a\": [i, if (true) { continue; }]}] }; i",
+	"let a = [0]; let i = 0; while (i < 5000) { i += 1; a[0] += if (i < 5000) { continue; } else { i } }; a",
+	"let i = 0; let x = 1 + if (true) { while (i < 5000) { i += 1; 2 * if (true) { continue; } }; i }; x",
+	"let i = 0; let r = 1 + if (true) { for (x in [1, 2, 3]) { i += x; [i, if (x == 2) { break; }] }; i }; [i, r]",
+}
+
+func TestEnginesProduceSameResults(t *testing.T) {
+	for _, input := range engineTestInputs {
+		evaluated := evaluator.Eval(parse(t, input), object.NewEnvironment())
+		expected := testInspect(evaluated)
+		received := testInspect(testRun(t, input))
+		if expected != received {
+			t.Errorf("Input %q: expected %s, received %s", input, expected, received)
+		}
+	}
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let fibonacci = fn(x) {
+			  if (x < 2) { return x; }
+			  fibonacci(x - 1) + fibonacci(x - 2)
+			};
+			fibonacci(15);`,
+			"610",
+		},
+		{
+			`let wrapper = fn() {
+			  let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+			  countDown(1);
+			};
+			wrapper();`,
+			"0",
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+			  let c = a + b;
+			  fn(d) {
+			    let e = d + c;
+			    fn(f) { e + f; };
+			  };
+			};
+			let newAdderInner = newAdderOuter(1, 2);
+			let adder = newAdderInner(3);
+			adder(8);`,
+			"14",
+		},
+		{"let f = fn() { f() }; f();", "ERROR: stack overflow"},
+	}
+	for _, testCase := range testCases {
+		received := testInspect(testRun(t, testCase.input))
+		if received != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, received)
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `let add = fn(a, b) {
+  a + b
+};
+let compute = fn(x) {
+  add(x, true)
+};
+compute(1);`
+
+	errObj, ok := testRun(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("Expected an error object")
+	}
+	expectedTrace := `ERROR: type mismatch: INTEGER + BOOLEAN
+  at 2:5
+  in add, called at 5:3
+  in compute, called at 7:1`
+	if errObj.StackTrace() != expectedTrace {
+		t.Errorf("Expected stack trace:\n%s\nreceived:\n%s", expectedTrace, errObj.StackTrace())
+	}
+}
+
+func TestCallbackErrorStackTrace(t *testing.T) {
+	input := `let check = fn(x) {
+  x + true
+};
+map([1], check);`
+
+	errObj, ok := testRun(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("Expected an error object")
+	}
+	expectedTrace := `ERROR: type mismatch: INTEGER + BOOLEAN
+  at 2:5
+  in check, called at 4:1
+  in map, called at 4:1`
+	if errObj.StackTrace() != expectedTrace {
+		t.Errorf("Expected stack trace:\n%s\nreceived:\n%s", expectedTrace, errObj.StackTrace())
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	// OpIterNext expects an iterator on the stack
+	bytecode := &compiler.Bytecode{
+		Instructions: append(code.Make(code.OpTrue), code.Make(code.OpIterNext, 0)...),
+		Positions:    map[int]token.Position{1: {Line: 3, Column: 7}},
+	}
+	err := New(bytecode).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("Expected an error object, received %T (%v)", err, err)
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("Expected an internal error, received %q", errObj.Message)
+	}
+	if errObj.Pos.String() != "3:7" {
+		t.Errorf("Expected position 3:7, received %s", errObj.Pos)
+	}
+}
+
+func TestGlobalsState(t *testing.T) {
+	symbolTable := compiler.NewGlobalSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GLOBALS_SIZE)
+
+	var result object.Object
+	for _, line := range []string{"let a = 1;", "let add = fn(x) { x + a };", "add(2)"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(t, line)); err != nil {
+			t.Fatalf("Compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobalsState(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("VM error: %s", err)
+		}
+		result = machine.LastPoppedStackElem()
+	}
+	if result.Inspect() != "3" {
+		t.Errorf("Expected 3, received %s", result.Inspect())
+	}
+}
+
+func TestSession(t *testing.T) {
+	session := NewSession()
+	session.Define("base", &object.Integer{Value: 10})
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1;", "null"},
+		{"let add = fn(x) { x + a + base };", "null"},
+		{"add(2)", "13"},
+		{"missing", "ERROR: identifier not found: missing"},
+		{"1 + true", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{"add(3)", "14"},
+	}
+	for _, testCase := range testCases {
+		result := session.Run(parse(t, testCase.input))
+		if result.Inspect() != testCase.expected {
+			t.Errorf("Input %q: expected %s, received %s", testCase.input, testCase.expected, result.Inspect())
+		}
+	}
+}